@@ -0,0 +1,55 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type optionAllocator func(reflect.Type) reflect.Value
+
+func (opt optionAllocator) apply(cfg *config) {
+	cfg.Allocator = opt
+}
+
+// WithAllocator makes UnmarshalWithTypeIDs to allocate new values through
+// the given function instead of reflect.New (for example, to take them
+// from a pool or an arena). The function should return a non-nil pointer
+// to a zero value of the given type, the same as reflect.New does
+// (otherwise the decoding fails with an error).
+//
+// It is used for the values retained by the decoded document: the targets
+// of nil pointers, and the values of interfaces constructed without
+// the NewByTypeIDer (for example, see RegisterDefaultImpl) or copied from
+// the values it returned. A NewByTypeIDer allocates its values by itself
+// (see also Pool), and the values decoded by "encoding/json" (for example,
+// leaves implementing json.Unmarshaler) are allocated by it.
+func WithAllocator(allocator func(reflect.Type) reflect.Value) Option {
+	return optionAllocator(allocator)
+}
+
+// new returns a pointer to a new zero value of the type
+// (see WithAllocator).
+func (u *unmarshaler) new(t reflect.Type) (reflect.Value, error) {
+	if u.Allocator == nil {
+		return reflect.New(t), nil
+	}
+	ptr := u.Allocator(t)
+	if !ptr.IsValid() {
+		return reflect.Value{}, fmt.Errorf("the allocator returned an invalid value instead of a non-nil %s", reflect.PointerTo(t))
+	}
+	if ptr.Type() != reflect.PointerTo(t) || ptr.IsNil() {
+		return reflect.Value{}, fmt.Errorf("the allocator returned %s instead of a non-nil %s", ptr.Type(), reflect.PointerTo(t))
+	}
+	return ptr, nil
+}
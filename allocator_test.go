@@ -0,0 +1,69 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAllocator(t *testing.T) {
+	var allocated []reflect.Value
+	allocator := func(t reflect.Type) reflect.Value {
+		ptr := reflect.New(t)
+		allocated = append(allocated, ptr)
+		return ptr
+	}
+
+	var dst struct {
+		Linear  *CalculatorLinear
+		Nested  **CalculatorLinear
+		Default Calculator
+	}
+	isolateTypeRegistry(t)
+	RegisterDefaultImpl((*Calculator)(nil), CalculatorLinear{})
+
+	b := []byte(`{"Linear":{"K":1},"Nested":{"K":2},"Default":{"K":3}}`)
+	require.NoError(t, UnmarshalWithTypeIDs(b, &dst, typeIDHandlerT{}, WithLenient(true), WithAllocator(allocator)))
+	require.Equal(t, &CalculatorLinear{K: 1}, dst.Linear)
+	require.Equal(t, CalculatorLinear{K: 2}, **dst.Nested)
+	require.Equal(t, CalculatorLinear{K: 3}, dst.Default)
+
+	var (
+		types    []reflect.Type
+		retained bool
+	)
+	for _, ptr := range allocated {
+		types = append(types, ptr.Type().Elem())
+		retained = retained || ptr.Interface() == any(dst.Linear)
+	}
+	require.ElementsMatch(t, []reflect.Type{
+		reflect.TypeOf(CalculatorLinear{}),
+		reflect.TypeOf(&CalculatorLinear{}),
+		reflect.TypeOf(CalculatorLinear{}),
+		reflect.TypeOf(CalculatorLinear{}),
+	}, types)
+	require.True(t, retained, "the allocated value is stored in the document")
+
+	t.Run("invalid_allocator", func(t *testing.T) {
+		var dst struct {
+			Linear *CalculatorLinear
+		}
+		err := UnmarshalWithTypeIDs([]byte(`{"Linear":{"K":1}}`), &dst, typeIDHandlerT{}, WithAllocator(func(reflect.Type) reflect.Value {
+			return reflect.ValueOf(&CalculatorConst{})
+		}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the allocator returned")
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"container/list"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// CachingResolver is a TypeIDHandler, which memoizes the results of
+// another TypeIDHandler (for example, a client of a remote schema registry)
+// to avoid repeated lookups during bulk encoding and decoding.
+//
+// Assumptions about the underlying TypeIDHandler:
+//   - TypeIDOf depends only on the type of the sample (not on its value),
+//     so it should not wrap a TypeIDHandler using instances (see RegisterInstance).
+//   - NewByTypeID returns new zero values (only the type of the value is
+//     memoized, values are constructed by reflection), so pre-filled values
+//     (see RegisterInstance) are not supported as well.
+//
+// Only the successful results and ErrTypeIDNotRegistered are memoized:
+// other errors (for example, a timeout of a remote schema registry)
+// may be transient, so the lookup is retried next time.
+type CachingResolver struct {
+	resolver   TypeIDHandler
+	maxEntries int
+	ttl        time.Duration
+
+	// now is the source of time (overridden in tests).
+	now func() time.Time
+
+	locker  sync.Mutex
+	types   *lruCache[TypeID, cachedType]
+	typeIDs *lruCache[reflect.Type, cachedTypeID]
+}
+
+var _ TypeIDHandler = (*CachingResolver)(nil)
+
+type cachedType struct {
+	Type reflect.Type
+	Err  error
+}
+
+type cachedTypeID struct {
+	TypeID TypeID
+	Err    error
+}
+
+// NewCachingResolver returns a new CachingResolver, which keeps up to
+// maxEntries results (per each direction, the least recently used are
+// evicted first) for up to ttl. Zero maxEntries or ttl means no limit.
+func NewCachingResolver(resolver TypeIDHandler, maxEntries int, ttl time.Duration) *CachingResolver {
+	return &CachingResolver{
+		resolver:   resolver,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		types:      newLRUCache[TypeID, cachedType](),
+		typeIDs:    newLRUCache[reflect.Type, cachedTypeID](),
+	}
+}
+
+// TypeIDOf implements TypeIDOfer.
+func (r *CachingResolver) TypeIDOf(sample any) (TypeID, error) {
+	t := reflect.TypeOf(sample)
+	if t == nil {
+		return r.resolver.TypeIDOf(sample)
+	}
+
+	r.locker.Lock()
+	cached, ok := r.typeIDs.Get(t, r.now())
+	r.locker.Unlock()
+	if ok {
+		return cached.TypeID, cached.Err
+	}
+
+	typeID, err := r.resolver.TypeIDOf(sample)
+	if !isMemoizableError(err) {
+		return typeID, err
+	}
+
+	r.locker.Lock()
+	r.typeIDs.Put(t, cachedTypeID{TypeID: typeID, Err: err}, r.expiresAt(), r.maxEntries)
+	r.locker.Unlock()
+	return typeID, err
+}
+
+// NewByTypeID implements NewByTypeIDer.
+func (r *CachingResolver) NewByTypeID(typeID TypeID) (any, error) {
+	r.locker.Lock()
+	cached, ok := r.types.Get(typeID, r.now())
+	r.locker.Unlock()
+	if ok {
+		if cached.Err != nil || cached.Type == nil {
+			return nil, cached.Err
+		}
+		return newZeroValue(cached.Type).Interface(), nil
+	}
+
+	value, err := r.resolver.NewByTypeID(typeID)
+	if !isMemoizableError(err) {
+		return value, err
+	}
+
+	r.locker.Lock()
+	r.types.Put(typeID, cachedType{Type: reflect.TypeOf(value), Err: err}, r.expiresAt(), r.maxEntries)
+	r.locker.Unlock()
+	return value, err
+}
+
+// TypeIDs implements TypeIDLister if the underlying TypeIDHandler does
+// (the result is not memoized).
+func (r *CachingResolver) TypeIDs() []TypeID {
+	lister, ok := r.resolver.(TypeIDLister)
+	if !ok {
+		return nil
+	}
+	return lister.TypeIDs()
+}
+
+// Purge forgets all the memoized results.
+func (r *CachingResolver) Purge() {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.types = newLRUCache[TypeID, cachedType]()
+	r.typeIDs = newLRUCache[reflect.Type, cachedTypeID]()
+}
+
+func (r *CachingResolver) expiresAt() time.Time {
+	if r.ttl <= 0 {
+		return time.Time{}
+	}
+	return r.now().Add(r.ttl)
+}
+
+// isMemoizableError returns true if the result with the error
+// could be memoized (see CachingResolver).
+func isMemoizableError(err error) bool {
+	return err == nil || errors.As(err, &ErrTypeIDNotRegistered{})
+}
+
+// newZeroValue returns a new value of the type the same as a NewByTypeIDer
+// normally returns: a pointer to a new zero value (for example new(T)).
+func newZeroValue(t reflect.Type) reflect.Value {
+	if t.Kind() != reflect.Pointer {
+		return reflect.Zero(t)
+	}
+	return reflect.New(t.Elem())
+}
+
+// lruCache is a map, which evicts the least recently used entries.
+// It is not thread-safe.
+type lruCache[K comparable, V any] struct {
+	entries map[K]*list.Element
+	order   *list.List
+}
+
+type lruEntry[K comparable, V any] struct {
+	Key       K
+	Value     V
+	ExpiresAt time.Time
+}
+
+func newLRUCache[K comparable, V any]() *lruCache[K, V] {
+	return &lruCache[K, V]{
+		entries: map[K]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Get returns the value if it is present and not expired by the time now.
+func (c *lruCache[K, V]) Get(key K, now time.Time) (V, bool) {
+	item, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	entry := item.Value.(*lruEntry[K, V])
+	if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+		c.order.Remove(item)
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(item)
+	return entry.Value, true
+}
+
+// Put stores the value (zero expiresAt means it never expires) and evicts
+// the least recently used entries beyond maxEntries (zero means no limit).
+func (c *lruCache[K, V]) Put(key K, value V, expiresAt time.Time, maxEntries int) {
+	if item, ok := c.entries[key]; ok {
+		c.order.Remove(item)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{Key: key, Value: value, ExpiresAt: expiresAt})
+	for maxEntries > 0 && c.order.Len() > maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).Key)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingTypeIDHandler counts the calls of the underlying TypeIDHandler.
+type countingTypeIDHandler struct {
+	TypeIDHandler
+	TypeIDOfCalls    int
+	NewByTypeIDCalls int
+}
+
+func (h *countingTypeIDHandler) TypeIDOf(sample any) (TypeID, error) {
+	h.TypeIDOfCalls++
+	return h.TypeIDHandler.TypeIDOf(sample)
+}
+
+func (h *countingTypeIDHandler) NewByTypeID(typeID TypeID) (any, error) {
+	h.NewByTypeIDCalls++
+	return h.TypeIDHandler.NewByTypeID(typeID)
+}
+
+// flakyTypeIDHandler fails the next call with Err (once).
+type flakyTypeIDHandler struct {
+	TypeIDHandler
+	Err error
+}
+
+func (h *flakyTypeIDHandler) TypeIDOf(sample any) (TypeID, error) {
+	if err := h.Err; err != nil {
+		h.Err = nil
+		return "", err
+	}
+	return h.TypeIDHandler.TypeIDOf(sample)
+}
+
+func (h *flakyTypeIDHandler) NewByTypeID(typeID TypeID) (any, error) {
+	if err := h.Err; err != nil {
+		h.Err = nil
+		return nil, err
+	}
+	return h.TypeIDHandler.NewByTypeID(typeID)
+}
+
+func TestCachingResolver(t *testing.T) {
+	counting := &countingTypeIDHandler{TypeIDHandler: typeIDHandlerT{}}
+	resolver := NewCachingResolver(counting, 0, 0)
+
+	obj := []Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}, CalculatorLinear{K: 3}, &CalculatorConst{C: 4}}
+	b, err := MarshalWithTypeIDs(obj, resolver)
+	require.NoError(t, err)
+	require.Equal(t, 2, counting.TypeIDOfCalls)
+
+	for i := 0; i < 3; i++ {
+		var cpy []Calculator
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, resolver))
+		require.Equal(t, obj, cpy)
+	}
+	require.Equal(t, 2, counting.NewByTypeIDCalls)
+
+	t.Run("errors", func(t *testing.T) {
+		counting := &countingTypeIDHandler{TypeIDHandler: TypeRegistry()}
+		resolver := NewCachingResolver(counting, 0, 0)
+		for i := 0; i < 3; i++ {
+			_, err := resolver.NewByTypeID("unknown")
+			require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+		}
+		require.Equal(t, 1, counting.NewByTypeIDCalls)
+	})
+
+	t.Run("transient_errors", func(t *testing.T) {
+		errTimeout := errors.New("timeout")
+		flaky := &flakyTypeIDHandler{TypeIDHandler: typeIDHandlerT{}, Err: errTimeout}
+		resolver := NewCachingResolver(flaky, 0, 0)
+
+		_, err := resolver.NewByTypeID("github.com/xaionaro-go/polyjson.CalculatorConst")
+		require.ErrorIs(t, err, errTimeout)
+		value, err := resolver.NewByTypeID("github.com/xaionaro-go/polyjson.CalculatorConst")
+		require.NoError(t, err)
+		require.Equal(t, &CalculatorConst{}, value)
+
+		flaky.Err = errTimeout
+		_, err = resolver.TypeIDOf(CalculatorLinear{})
+		require.ErrorIs(t, err, errTimeout)
+		typeID, err := resolver.TypeIDOf(CalculatorLinear{})
+		require.NoError(t, err)
+		require.Equal(t, TypeID("github.com/xaionaro-go/polyjson.CalculatorLinear"), typeID)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		counting := &countingTypeIDHandler{TypeIDHandler: typeIDHandlerT{}}
+		resolver := NewCachingResolver(counting, 0, time.Minute)
+		now := time.Unix(0, 0)
+		resolver.now = func() time.Time { return now }
+
+		_, err := resolver.TypeIDOf(CalculatorLinear{})
+		require.NoError(t, err)
+		now = now.Add(30 * time.Second)
+		_, err = resolver.TypeIDOf(CalculatorLinear{})
+		require.NoError(t, err)
+		require.Equal(t, 1, counting.TypeIDOfCalls)
+
+		now = now.Add(time.Minute)
+		_, err = resolver.TypeIDOf(CalculatorLinear{})
+		require.NoError(t, err)
+		require.Equal(t, 2, counting.TypeIDOfCalls)
+	})
+
+	t.Run("max_entries", func(t *testing.T) {
+		counting := &countingTypeIDHandler{TypeIDHandler: typeIDHandlerT{}}
+		resolver := NewCachingResolver(counting, 1, 0)
+
+		for _, typeID := range []TypeID{
+			"github.com/xaionaro-go/polyjson.CalculatorLinear",
+			"github.com/xaionaro-go/polyjson.CalculatorConst",
+			"github.com/xaionaro-go/polyjson.CalculatorLinear",
+		} {
+			_, err := resolver.NewByTypeID(typeID)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 3, counting.NewByTypeIDCalls)
+
+		resolver.Purge()
+		_, err := resolver.NewByTypeID("github.com/xaionaro-go/polyjson.CalculatorLinear")
+		require.NoError(t, err)
+		require.Equal(t, 4, counting.NewByTypeIDCalls)
+	})
+
+	t.Run("fresh_values", func(t *testing.T) {
+		resolver := NewCachingResolver(typeIDHandlerT{}, 0, 0)
+		var values []any
+		for i := 0; i < 2; i++ {
+			value, err := resolver.NewByTypeID("github.com/xaionaro-go/polyjson.CalculatorConst")
+			require.NoError(t, err)
+			require.Equal(t, &CalculatorConst{}, value)
+			value.(*CalculatorConst).C = 1
+			values = append(values, value)
+		}
+		require.NotSame(t, values[0], values[1])
+	})
+}
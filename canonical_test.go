@@ -0,0 +1,54 @@
+// Copyright 2025 Dmitrii Okunev.
+// Copyright 2023 Meta Platforms, Inc. and affiliates.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type canonicalCustom struct{}
+
+func (canonicalCustom) MarshalJSON() ([]byte, error) {
+	return []byte(`{ "b": 1.50, "a": "<&>", "c": [1E2, 0.0000001, -0] }`), nil
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	type declaredAB struct {
+		A int
+		B []canonicalCustom
+	}
+	type declaredBA struct {
+		B []canonicalCustom
+		A int
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	b0, err := MarshalCanonical(declaredAB{A: 1, B: []canonicalCustom{{}}}, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"A":1,"B":[{"a":"<&>","b":1.5,"c":[100,1e-7,0]}]}`, string(b0))
+
+	b1, err := MarshalCanonical(declaredBA{A: 1, B: []canonicalCustom{{}}}, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, string(b0), string(b1))
+
+	b, err := MarshalCanonical(map[string]any{
+		"\U0001F600": 1,
+		"\uff61":     2,
+		"x":          "line\nbreak\u0001",
+		"big":        uint64(18446744073709551615),
+	}, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"big":{".uint64":18446744073709551615},"x":{".string":"line\nbreak\u0001"},"`+"\U0001F600"+`":{".int":1},"`+"\uff61"+`":{".int":2}}`, string(b))
+}
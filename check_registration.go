@@ -0,0 +1,54 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// CheckRegistration makes a dry-run marshaling of the given value
+// and reports every interface value (reachable from root), which
+// concrete type is not registered in the type registry
+// (see RegisterType).
+//
+// It does not register anything (even if AutoRegisterTypes is enabled),
+// so it could be used in tests to prevent "forgot to register" regressions.
+func CheckRegistration(root any) error {
+	var errs []error
+	m := &marshaler{
+		typeIDOfer: registeredTypeIDOfer{},
+		typeIDErrorHandler: func(path valuePath, err error) error {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			return nil
+		},
+	}
+	if _, err := m.marshal(reflect.ValueOf(root), nil); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// registeredTypeIDOfer is a TypeIDOfer which accepts only already registered types.
+type registeredTypeIDOfer struct{}
+
+// TypeIDOf implements TypeIDOfer.
+func (registeredTypeIDOfer) TypeIDOf(sample any) (TypeID, error) {
+	t := typeOf(sample)
+	id, ok := typeIDs[t]
+	if !ok {
+		return "", ErrTypeIDNotRegistered{TypeID: typeToID(t)}
+	}
+	return id, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// DefaultEnvelopeVersionKey is the default key of the version field
+	// of an envelope (see MarshalEnvelope and WithEnvelopeKeys).
+	DefaultEnvelopeVersionKey = "v"
+
+	// DefaultEnvelopeDataKey is the default key of the data field
+	// of an envelope (see MarshalEnvelope and WithEnvelopeKeys).
+	DefaultEnvelopeDataKey = "data"
+)
+
+type optionEnvelopeKeys struct {
+	VersionKey string
+	DataKey    string
+}
+
+func (opt optionEnvelopeKeys) apply(cfg *config) {
+	cfg.EnvelopeVersionKey = opt.VersionKey
+	cfg.EnvelopeDataKey = opt.DataKey
+}
+
+// WithEnvelopeKeys sets the keys of the version and data fields of
+// an envelope for MarshalEnvelope and UnmarshalEnvelope (by default
+// DefaultEnvelopeVersionKey and DefaultEnvelopeDataKey), for example
+// to match an existing storage format. The option should be used on both sides.
+func WithEnvelopeKeys(versionKey, dataKey string) Option {
+	return optionEnvelopeKeys{VersionKey: versionKey, DataKey: dataKey}
+}
+
+// envelopeKeys returns the keys of the version and data fields
+// of an envelope (see WithEnvelopeKeys).
+func (cfg *config) envelopeKeys() (string, string) {
+	versionKey, dataKey := cfg.EnvelopeVersionKey, cfg.EnvelopeDataKey
+	if versionKey == "" {
+		versionKey = DefaultEnvelopeVersionKey
+	}
+	if dataKey == "" {
+		dataKey = DefaultEnvelopeDataKey
+	}
+	return versionKey, dataKey
+}
+
+// MarshalEnvelope is similar to MarshalWithTypeIDs, but wraps the
+// result into a versioned envelope:
+//
+//	{"v":1,"data":{...}}
+//
+// It provides a migration seam at the document level: see UnmarshalEnvelope.
+func MarshalEnvelope(obj any, typeIDOfer TypeIDOfer, version int, opts ...Option) ([]byte, error) {
+	data, err := MarshalWithTypeIDs(obj, typeIDOfer, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Options(opts).config()
+	versionKeyName, dataKeyName := cfg.envelopeKeys()
+	versionKey, err := json.Marshal(versionKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize the version key '%s': %w", versionKeyName, err)
+	}
+	dataKey, err := json.Marshal(dataKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize the data key '%s': %w", dataKeyName, err)
+	}
+
+	// constructing manually to keep the version before the data
+	return fmt.Appendf(nil, `{%s:%d,%s:%s}`, versionKey, version, dataKey, data), nil
+}
+
+// UnmarshalEnvelope parses an envelope produced by MarshalEnvelope
+// and calls the handler dedicated to the version of the document.
+// The handler receives the data of the document (which could be
+// parsed using UnmarshalWithTypeIDs).
+//
+// For example:
+//
+//	err := polyjson.UnmarshalEnvelope(b, map[int]func([]byte) error{
+//	    1: func(data []byte) error {
+//	        var cfg ConfigV1
+//	        if err := polyjson.UnmarshalWithTypeIDs(data, &cfg, polyjson.TypeRegistry()); err != nil {
+//	            return err
+//	        }
+//	        result = cfg.Migrate()
+//	        return nil
+//	    },
+//	    2: func(data []byte) error {
+//	        return polyjson.UnmarshalWithTypeIDs(data, &result, polyjson.TypeRegistry())
+//	    },
+//	})
+//
+// The options define the keys of the envelope (see WithEnvelopeKeys).
+func UnmarshalEnvelope(b []byte, handlers map[int]func(data []byte) error, opts ...Option) error {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		return fmt.Errorf("unable to parse the envelope: %w", err)
+	}
+
+	cfg := Options(opts).config()
+	versionKey, dataKey := cfg.envelopeKeys()
+	versionRaw, ok := envelope[versionKey]
+	if !ok {
+		return fmt.Errorf("the envelope has no version field '%s'", versionKey)
+	}
+	var version int
+	if err := json.Unmarshal(versionRaw, &version); err != nil {
+		return fmt.Errorf("unable to parse the version '%s': %w", versionRaw, err)
+	}
+
+	data, ok := envelope[dataKey]
+	if !ok {
+		return fmt.Errorf("the envelope has no data field '%s'", dataKey)
+	}
+
+	handler, ok := handlers[version]
+	if !ok {
+		return ErrUnsupportedEnvelopeVersion{Version: version}
+	}
+	return handler(data)
+}
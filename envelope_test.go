@@ -0,0 +1,68 @@
+// Copyright 2025 Dmitrii Okunev.
+// Copyright 2023 Meta Platforms, Inc. and affiliates.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	testObj := Strategy{Name: "linear", Calculator: CalculatorLinear{K: 2}}
+
+	b, err := MarshalEnvelope(testObj, typeIDHandler, 2)
+	require.NoError(t, err)
+	require.Equal(t, `{"v":2,"data":{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}},"Name":"linear"}}`, string(b))
+
+	var (
+		cpy       Strategy
+		v1Invoked bool
+	)
+	handlers := map[int]func([]byte) error{
+		1: func([]byte) error {
+			v1Invoked = true
+			return nil
+		},
+		2: func(data []byte) error {
+			return UnmarshalWithTypeIDs(data, &cpy, typeIDHandler)
+		},
+	}
+	err = UnmarshalEnvelope(b, handlers)
+	require.NoError(t, err)
+	require.False(t, v1Invoked)
+	require.Equal(t, testObj, cpy)
+
+	err = UnmarshalEnvelope([]byte(`{"v":3,"data":{}}`), handlers)
+	require.ErrorAs(t, err, &ErrUnsupportedEnvelopeVersion{})
+}
+
+func TestEnvelopeCustomKeys(t *testing.T) {
+	opt := WithEnvelopeKeys("schema", "payload")
+	b, err := MarshalEnvelope(Struct3{Int2: 1}, typeIDHandlerT{}, 1, opt)
+	require.NoError(t, err)
+	require.Equal(t, `{"schema":1,"payload":{"Int2":1}}`, string(b))
+
+	var cpy Struct3
+	err = UnmarshalEnvelope(b, map[int]func([]byte) error{
+		1: func(data []byte) error {
+			return UnmarshalWithTypeIDs(data, &cpy, typeIDHandlerT{})
+		},
+	}, opt)
+	require.NoError(t, err)
+	require.Equal(t, Struct3{Int2: 1}, cpy)
+
+	err = UnmarshalEnvelope(b, map[int]func([]byte) error{})
+	require.ErrorContains(t, err, "no version field 'v'")
+}
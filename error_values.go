@@ -0,0 +1,44 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/tidwall/gjson"
+)
+
+// errorKey is the key used to represent values of type `error` (see WithErrorValues).
+const errorKey = "error"
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func marshalError(err error) (json.RawMessage, error) {
+	return json.Marshal(map[string]string{
+		errorKey: err.Error(),
+	})
+}
+
+func unmarshalError(value gjson.Result) (error, error) {
+	if !value.IsObject() {
+		return nil, fmt.Errorf("expected {\"%s\":\"message\"} for an error value, but got '%s'", errorKey, value.Raw)
+	}
+	msg := value.Get(errorKey)
+	if msg.Type != gjson.String {
+		return nil, fmt.Errorf("expected {\"%s\":\"message\"} for an error value, but got '%s'", errorKey, value.Raw)
+	}
+	return errors.New(msg.Str), nil
+}
@@ -15,6 +15,8 @@ package polyjson
 
 import (
 	"fmt"
+	"reflect"
+	"time"
 )
 
 // ErrTypeIDNotRegistered means there was an attempt to serialize/deserialize a value
@@ -27,3 +29,153 @@ type ErrTypeIDNotRegistered struct {
 func (e ErrTypeIDNotRegistered) Error() string {
 	return fmt.Sprintf("type with TypeID '%s' is not registered", e.TypeID)
 }
+
+// ErrUnsupportedType means there was an attempt to serialize a value
+// of a type which cannot be represented in JSON (for example a channel or a function).
+type ErrUnsupportedType struct {
+	Type reflect.Type
+	Path string
+}
+
+// Error implements interface "error".
+func (e ErrUnsupportedType) Error() string {
+	return fmt.Sprintf("unsupported type %s at %s", e.Type, e.Path)
+}
+
+// ErrUnsupportedEnvelopeVersion means there was an attempt to deserialize
+// an envelope of a version, which has no handler (see UnmarshalEnvelope).
+type ErrUnsupportedEnvelopeVersion struct {
+	Version int
+}
+
+// Error implements interface "error".
+func (e ErrUnsupportedEnvelopeVersion) Error() string {
+	return fmt.Sprintf("unsupported envelope version %d", e.Version)
+}
+
+// ErrDuplicateKey means the document contains an object with duplicate keys
+// (see WithDisallowDuplicateKeys).
+type ErrDuplicateKey struct {
+	Key  string
+	Path string
+}
+
+// Error implements interface "error".
+func (e ErrDuplicateKey) Error() string {
+	return fmt.Sprintf("duplicate key '%s' at %s", e.Key, e.Path)
+}
+
+// ErrNotTypeTagged means the document contains a non-object JSON value
+// where a type-tagged object ({TypeID: {...}}) is expected for an interface
+// (or a non-array JSON value, see FormatTupleArray).
+type ErrNotTypeTagged struct {
+	Path     string
+	JSONType string
+}
+
+// Error implements interface "error".
+func (e ErrNotTypeTagged) Error() string {
+	return fmt.Sprintf("expected type-tagged value for interface value %s, got %s", e.Path, e.JSONType)
+}
+
+// ErrUnexportedType means there was an attempt to automatically register
+// (see AutoRegisterTypes) an unexported or an unnamed type. A document with
+// such TypeID could never be decoded by another package, because it cannot
+// reference the type to register it. Such types should be registered explicitly
+// by their own package (see RegisterTypeAs and RegisterTypeAlias).
+type ErrUnexportedType struct {
+	Type reflect.Type
+}
+
+// Error implements interface "error".
+func (e ErrUnexportedType) Error() string {
+	return fmt.Sprintf("type %s is unexported or unnamed, so it cannot be registered automatically; register it explicitly (e.g. using RegisterTypeAs)", e.Type)
+}
+
+// ErrAmbiguousTypeID means the TypeID in the document matches multiple
+// known TypeIDs after normalization (see WithTypeIDNormalization).
+type ErrAmbiguousTypeID struct {
+	TypeID     TypeID
+	Candidates []TypeID
+}
+
+// Error implements interface "error".
+func (e ErrAmbiguousTypeID) Error() string {
+	return fmt.Sprintf("TypeID '%s' is ambiguous, candidates: %v", e.TypeID, e.Candidates)
+}
+
+// ErrAmbiguousInstance means the value is of a type shared by multiple
+// instances registered through RegisterInstance, and it is none of them
+// (for example, it is a decoded copy), so its TypeID is unknown.
+type ErrAmbiguousInstance struct {
+	Type       reflect.Type
+	Candidates []TypeID
+}
+
+// Error implements interface "error".
+func (e ErrAmbiguousInstance) Error() string {
+	return fmt.Sprintf("the TypeID of a value of type %s is ambiguous (it is not a registered instance), candidates: %v", e.Type, e.Candidates)
+}
+
+// ErrTypeIDNotAllowed means the document contains a TypeID, which
+// is not allowed for the field (see tag `polyjson:"oneof=..."`).
+type ErrTypeIDNotAllowed struct {
+	TypeID  TypeID
+	Path    string
+	Allowed []string
+}
+
+// Error implements interface "error".
+func (e ErrTypeIDNotAllowed) Error() string {
+	return fmt.Sprintf("TypeID '%s' is not allowed at %s, allowed: %v", e.TypeID, e.Path, e.Allowed)
+}
+
+// ErrTrailingData means the document contains something but whitespace
+// after the top-level value (see WithDisallowTrailingData).
+type ErrTrailingData struct {
+	Offset int64
+}
+
+// Error implements interface "error".
+func (e ErrTrailingData) Error() string {
+	return fmt.Sprintf("unexpected data after the top-level value at offset %d", e.Offset)
+}
+
+// ErrDecodeTimeout means the decoding took longer than allowed
+// (see WithDecodeTimeout).
+type ErrDecodeTimeout struct {
+	Timeout time.Duration
+	Path    string
+}
+
+// Error implements interface "error".
+func (e ErrDecodeTimeout) Error() string {
+	return fmt.Sprintf("decoding exceeded the timeout %s at %s", e.Timeout, e.Path)
+}
+
+// ErrPathNotFound means the document has no value
+// at the given gjson path (see SetTyped).
+type ErrPathNotFound struct {
+	Path string
+}
+
+// Error implements interface "error".
+func (e ErrPathNotFound) Error() string {
+	return fmt.Sprintf("no value at path '%s'", e.Path)
+}
+
+// ErrUnsupportedFormatVersion means the format marker of the document
+// is absent or has an unknown version (see WithFormatMarker). Version
+// is the raw JSON value of the marker (empty if the marker is absent).
+type ErrUnsupportedFormatVersion struct {
+	Key     string
+	Version string
+}
+
+// Error implements interface "error".
+func (e ErrUnsupportedFormatVersion) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("no format marker '%s' at the top level", e.Key)
+	}
+	return fmt.Sprintf("unsupported format version '%s' in marker '%s', expected '%s'", e.Version, e.Key, FormatVersion)
+}
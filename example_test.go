@@ -36,3 +36,50 @@ func ExampleUnmarshalWithTypeIDs() {
 	// Output:
 	// {"B":{"./polyjson_test.myFancyStruct":{"A":1}}}
 }
+
+type shape interface {
+	Area() float64
+}
+
+type square struct {
+	Side float64
+}
+
+func (s square) Area() float64 { return s.Side * s.Side }
+
+type circle struct {
+	R float64
+}
+
+func (c *circle) Area() float64 { return 3 * c.R * c.R }
+
+func ExampleUnmarshalWithTypeIDs_typedMap() {
+	polyjson.RegisterType(square{})
+	polyjson.RegisterType(circle{})
+
+	// serialize:
+
+	b, err := polyjson.MarshalWithTypeIDs(map[string]shape{
+		"a": square{Side: 2},
+		"b": &circle{R: 1},
+		"c": nil,
+	}, polyjson.TypeRegistry())
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(b))
+
+	// deserialize:
+
+	var cpy map[string]shape
+	err = polyjson.UnmarshalWithTypeIDs(b, &cpy, polyjson.TypeRegistry())
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%#v %#v %v\n", cpy["a"], cpy["b"], cpy["c"])
+
+	// Output:
+	// {"a":{"./polyjson_test.square":{"Side":2}},"b":{"./polyjson_test.circle":{"R":1}},"c":null}
+	// polyjson_test.square{Side:2} &polyjson_test.circle{R:1} <nil>
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Explain renders the document (serialized by MarshalWithTypeIDs) as
+// an indented tree, where every type-tagged value (`{TypeID:content}`)
+// is annotated with the Go type it is decoded into, for example:
+//
+//	{
+//	  "Calculator": "CalculatorLinear" (polyjson.CalculatorLinear) {
+//	    "K": 1
+//	  }
+//	}
+//
+// It is a diagnostic tool to see how the document would be interpreted.
+//
+// Since the document has no schema, a single-key object is considered
+// type-tagged if the key is a TypeID known to the NewByTypeIDer, or
+// if the key looks like a qualified TypeID (contains a dot) and the content
+// is an object or an array. In the latter case the type is "UNKNOWN".
+//
+// The options are the same as for UnmarshalWithTypeIDs (for example WithFormat).
+func Explain(b []byte, newByTypeIDer NewByTypeIDer, opts ...Option) (string, error) {
+	if !gjson.ValidBytes(b) {
+		return "", fmt.Errorf("invalid JSON")
+	}
+
+	u := &unmarshaler{
+		newByTypeIDer: newByTypeIDer,
+		config:        Options(opts).config(),
+	}
+	var buf bytes.Buffer
+	if err := u.explainValue(&buf, gjson.ParseBytes(b), 0); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (u *unmarshaler) explainValue(buf *bytes.Buffer, value gjson.Result, depth int) error {
+	if typeID, goType, content, ok := u.explainWrapper(value); ok {
+		if err := writeJSONString(buf, typeID); err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, " (%s) ", goType)
+		return u.explainValue(buf, content, depth)
+	}
+
+	var err error
+	switch {
+	case value.IsObject():
+		buf.WriteString("{")
+		count := 0
+		value.ForEach(func(key, item gjson.Result) bool {
+			if count > 0 {
+				buf.WriteByte(',')
+			}
+			count++
+			explainIndent(buf, depth+1)
+			if err = writeJSONString(buf, key.Str); err != nil {
+				return false
+			}
+			buf.WriteString(": ")
+			err = u.explainValue(buf, item, depth+1)
+			return err == nil
+		})
+		if count > 0 {
+			explainIndent(buf, depth)
+		}
+		buf.WriteString("}")
+	case value.IsArray():
+		items := value.Array()
+		if len(items) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[")
+		for idx, item := range items {
+			if idx > 0 {
+				buf.WriteByte(',')
+			}
+			explainIndent(buf, depth+1)
+			if err = u.explainValue(buf, item, depth+1); err != nil {
+				return err
+			}
+		}
+		explainIndent(buf, depth)
+		buf.WriteString("]")
+	default:
+		buf.WriteString(value.Raw)
+	}
+	return err
+}
+
+// explainWrapper returns the TypeID, the name of the Go type to be stored
+// in an interface for it (or "UNKNOWN"), and the content if the value
+// is considered type-tagged (see Explain).
+func (u *unmarshaler) explainWrapper(value gjson.Result) (string, string, gjson.Result, bool) {
+	typeID, content, count := u.unpackWrapper(value)
+	if count != 1 {
+		return "", "", gjson.Result{}, false
+	}
+	if sample, err := u.newByTypeID(TypeID(typeID)); err == nil && sample != nil {
+		defer u.release(sample)
+		t := reflect.TypeOf(sample)
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		return typeID, t.String(), content, true
+	}
+	if strings.Contains(typeID, ".") && (content.IsObject() || content.IsArray()) {
+		return typeID, "UNKNOWN", content, true
+	}
+	return "", "", gjson.Result{}, false
+}
+
+func explainIndent(buf *bytes.Buffer, depth int) {
+	buf.WriteByte('\n')
+	buf.WriteString(strings.Repeat("  ", depth))
+}
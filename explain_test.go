@@ -0,0 +1,70 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type doc struct {
+		Calculators []Calculator
+		Empty       map[string]int
+	}
+	obj := doc{
+		Calculators: []Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}, nil},
+		Empty:       map[string]int{},
+	}
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+
+	s, err := Explain(b, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{
+  "Calculators": [
+    "github.com/xaionaro-go/polyjson.CalculatorLinear" (polyjson.CalculatorLinear) {
+      "K": 1
+    },
+    "*github.com/xaionaro-go/polyjson.CalculatorConst" (*polyjson.CalculatorConst) {
+      "C": 2
+    },
+    null
+  ],
+  "Empty": {}
+}`, s)
+
+	s, err = Explain([]byte(`{"a":{"github.com/my/app.Unknown":{"A":1}},"b":{"K":1}}`), typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{
+  "a": "github.com/my/app.Unknown" (UNKNOWN) {
+    "A": 1
+  },
+  "b": {
+    "K": 1
+  }
+}`, s)
+
+	// the wrappers are recognized according to the format
+	s, err = Explain([]byte(`{"a":["github.com/xaionaro-go/polyjson.CalculatorLinear",{"K":1}]}`), typeIDHandler, WithFormat(FormatTupleArray))
+	require.NoError(t, err)
+	require.Equal(t, `{
+  "a": "github.com/xaionaro-go/polyjson.CalculatorLinear" (polyjson.CalculatorLinear) {
+    "K": 1
+  }
+}`, s)
+
+	_, err = Explain([]byte(`{`), typeIDHandler)
+	require.Error(t, err)
+}
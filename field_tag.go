@@ -0,0 +1,142 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// fieldTag is the parsed `json:"..."` tag of a structure field.
+type fieldTag struct {
+	// Name is the JSON field name.
+	Name string
+
+	// Options are the comma-separated words after the name.
+	Options []string
+}
+
+// parseFieldTag returns the parsed tag of the given structure field,
+// or false if the field is requested to be skipped.
+//
+// The edge cases are the same as in "encoding/json": `json:"-"` skips
+// the field, while `json:"-,"` names it "-"; an empty or an invalid name
+// (for example `json:",omitempty"`) falls back to the name of the field.
+func parseFieldTag(fT reflect.StructField) (fieldTag, bool) {
+	tag := fT.Tag.Get("json")
+	if tag == "-" {
+		// requested to skip
+		return fieldTag{}, false
+	}
+	tagWords := strings.Split(tag, ",")
+
+	jsonFieldName := fT.Name
+	if isValidTagName(tagWords[0]) {
+		jsonFieldName = tagWords[0]
+	}
+
+	return fieldTag{
+		Name:    jsonFieldName,
+		Options: tagWords[1:],
+	}, true
+}
+
+// isValidTagName returns true if the name is allowed to be used
+// as a JSON field name (the same rules as in "encoding/json").
+func isValidTagName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+			// Backslash and quote chars are reserved, but
+			// otherwise any punctuation chars are allowed
+			// in a tag name.
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+	return true
+}
+
+// HasOption returns true if the option is set in the tag.
+func (tag fieldTag) HasOption(option string) bool {
+	return slices.Contains(tag.Options, option)
+}
+
+// isStringified returns true if the value of the field should be stored
+// as JSON inside a JSON string: either the field is tagged with option "string",
+// or its type is registered through RegisterStringifiedNumberType.
+//
+// Same as in "encoding/json", it applies only to fields of string,
+// floating point, integer, or boolean types, or of (unnamed) pointers
+// to them; a nil pointer is stored as null.
+func isStringified(fT reflect.StructField, tag fieldTag) bool {
+	t := fT.Type
+	if t.Kind() == reflect.Pointer && t.Name() == "" {
+		t = t.Elem()
+	}
+	if !isNumeric(t) && t.Kind() != reflect.String && t.Kind() != reflect.Bool {
+		return false
+	}
+	if tag.HasOption("string") {
+		return true
+	}
+	_, ok := stringifiedNumberTypes[t]
+	return ok
+}
+
+// leadsToInterface returns true if the type is an interface, or a pointer,
+// a slice, an array or a map (possibly nested) of interfaces.
+func leadsToInterface(t reflect.Type) bool {
+	for {
+		switch t.Kind() {
+		case reflect.Interface:
+			return true
+		case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+}
+
+// parsePolyjsonTag returns the parsed `polyjson:"key=value,..."` tag of
+// the structure field. A comma-separated word without "=" is considered
+// a continuation of the previous value, for example
+// `polyjson:"oneof=A,B"` is parsed as {"oneof": "A,B"}.
+func parsePolyjsonTag(fT reflect.StructField) map[string]string {
+	tag, ok := fT.Tag.Lookup("polyjson")
+	if !ok {
+		return nil
+	}
+
+	result := map[string]string{}
+	var lastKey string
+	for _, word := range strings.Split(tag, ",") {
+		key, value, ok := strings.Cut(word, "=")
+		if !ok {
+			if lastKey != "" {
+				result[lastKey] += "," + word
+				continue
+			}
+			value = ""
+		}
+		result[key] = value
+		lastKey = key
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// Format is the representation of values of interfaces (see WithFormat).
+type Format int
+
+const (
+	// FormatWrapperObject represents a value of an interface as
+	// a single-key object: {"TypeID": content}. This is the default.
+	FormatWrapperObject = Format(iota)
+
+	// FormatTupleArray represents a value of an interface as
+	// a 2-item array: ["TypeID", content].
+	FormatTupleArray
+)
+
+// String implements fmt.Stringer.
+func (f Format) String() string {
+	switch f {
+	case FormatWrapperObject:
+		return "WrapperObject"
+	case FormatTupleArray:
+		return "TupleArray"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+type optionFormat Format
+
+func (opt optionFormat) apply(cfg *config) {
+	cfg.Format = Format(opt)
+}
+
+// WithFormat sets the representation of values of interfaces for both
+// MarshalWithTypeIDs and UnmarshalWithTypeIDs, for example FormatTupleArray
+// to interoperate with formats using the compact ["TypeID", content] tagged unions.
+// The option should be used on both sides, and also with the tools
+// inspecting the documents (Validate, Explain, ScanTypeIDs and RewriteTypeIDs).
+func WithFormat(format Format) Option {
+	return optionFormat(format)
+}
+
+// marshalWrapper is the same as the function marshalWrapper, but in the configured
+// format (see WithFormat).
+func (m *marshaler) marshalWrapper(typeID TypeID, content []byte) (json.RawMessage, error) {
+	if m.Format == FormatTupleArray {
+		return marshalTuple(typeID, content)
+	}
+	return marshalWrapper(typeID, content)
+}
+
+// marshalTuple returns ["TypeID", content].
+func marshalTuple(typeID TypeID, content []byte) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(typeID) + len(content) + 5)
+	buf.WriteByte('[')
+	if err := writeJSONString(&buf, string(typeID)); err != nil {
+		return nil, fmt.Errorf("unable to serialize TypeID '%s': %w", typeID, err)
+	}
+	buf.WriteByte(',')
+	buf.Write(content)
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// unpackWrapper is the same as the function unpackWrapper, but in the configured
+// format (see WithFormat).
+func (u *unmarshaler) unpackWrapper(value gjson.Result) (string, gjson.Result, int) {
+	if u.Format == FormatTupleArray {
+		return unpackTuple(value)
+	}
+	return unpackWrapper(value)
+}
+
+// unpackTuple returns the TypeID and the content of ["TypeID", content],
+// and 1 as the amount of TypeIDs (to be consistent with unpackWrapper),
+// or 0 if the value is not such a tuple.
+func unpackTuple(value gjson.Result) (string, gjson.Result, int) {
+	if !value.IsArray() {
+		return "", gjson.Result{}, 0
+	}
+	items := value.Array()
+	if len(items) != 2 || items[0].Type != gjson.String {
+		return "", gjson.Result{}, 0
+	}
+	return items[0].Str, items[1], 1
+}
+
+// isWrapperContainer returns true if the value has the JSON type
+// of the representation of values of interfaces (see WithFormat).
+func (u *unmarshaler) isWrapperContainer(value gjson.Result) bool {
+	if u.Format == FormatTupleArray {
+		return value.IsArray()
+	}
+	return value.IsObject()
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// FormatVersion is the version of the format put
+// into the format marker (see WithFormatMarker).
+const FormatVersion = "1"
+
+type optionFormatMarker string
+
+func (opt optionFormatMarker) apply(cfg *config) {
+	cfg.FormatMarker = string(opt)
+}
+
+// WithFormatMarker makes MarshalWithTypeIDs to put the field
+// `"<key>":"<FormatVersion>"` (for example `"__polyjson":"1"`) first
+// into the top-level object, and UnmarshalWithTypeIDs to require and
+// strip it (ErrUnsupportedFormatVersion is returned if the marker
+// is absent or has another version). It allows to detect documents
+// of incompatible versions of the format in the future.
+//
+// For consumers using "encoding/json" the marker is an ordinary
+// unknown field. The top-level value should be an object, and
+// the option should be used on both sides.
+func WithFormatMarker(key string) Option {
+	return optionFormatMarker(key)
+}
+
+// addFormatMarker puts the format marker into the marshaled
+// top-level object b (see WithFormatMarker).
+func (m *marshaler) addFormatMarker(b []byte) ([]byte, error) {
+	if m.FormatMarker == "" {
+		return b, nil
+	}
+	root := gjson.ParseBytes(b)
+	if !root.IsObject() {
+		return nil, fmt.Errorf("the format marker requires an object at the top level, but got %s", jsonTypeName(root))
+	}
+	if root.Get(gjson.Escape(m.FormatMarker)).Exists() {
+		return nil, fmt.Errorf("the top-level object already has field '%s' (reserved for the format marker)", m.FormatMarker)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(b) + len(m.FormatMarker) + len(FormatVersion) + 6)
+	buf.WriteByte('{')
+	if err := writeJSONString(&buf, m.FormatMarker); err != nil {
+		return nil, fmt.Errorf("unable to serialize the format marker '%s': %w", m.FormatMarker, err)
+	}
+	buf.WriteByte(':')
+	if err := writeJSONString(&buf, FormatVersion); err != nil {
+		return nil, fmt.Errorf("unable to serialize the format version '%s': %w", FormatVersion, err)
+	}
+	if content := bytes.TrimSpace(b[1:]); len(content) > 0 && content[0] != '}' {
+		buf.WriteByte(',')
+	}
+	buf.Write(b[1:])
+	return buf.Bytes(), nil
+}
+
+// stripFormatMarker validates and removes the format marker
+// from the top-level object (see WithFormatMarker).
+func (u *unmarshaler) stripFormatMarker(root gjson.Result) (gjson.Result, error) {
+	if u.FormatMarker == "" {
+		return root, nil
+	}
+	if !root.IsObject() {
+		return gjson.Result{}, ErrUnsupportedFormatVersion{Key: u.FormatMarker}
+	}
+
+	var (
+		version gjson.Result
+		buf     bytes.Buffer
+	)
+	buf.WriteByte('{')
+	root.ForEach(func(key, value gjson.Result) bool {
+		if key.Str == u.FormatMarker {
+			version = value
+			return true
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(key.Raw)
+		buf.WriteByte(':')
+		buf.WriteString(value.Raw)
+		return true
+	})
+	buf.WriteByte('}')
+
+	switch {
+	case !version.Exists():
+		return gjson.Result{}, ErrUnsupportedFormatVersion{Key: u.FormatMarker}
+	case version.Type != gjson.String || version.Str != FormatVersion:
+		return gjson.Result{}, ErrUnsupportedFormatVersion{Key: u.FormatMarker, Version: version.Raw}
+	}
+	return gjson.Parse(buf.String()), nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatMarker(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type document struct {
+		Calculator Calculator
+		Name       string
+	}
+	obj := document{Calculator: CalculatorLinear{K: 1}, Name: "x"}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler, WithFormatMarker("__polyjson"))
+	require.NoError(t, err)
+	require.Equal(t, `{"__polyjson":"1","Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"Name":"x"}`, string(b))
+
+	var cpy document
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithFormatMarker("__polyjson")))
+	require.Equal(t, obj, cpy)
+
+	// ignorable by "encoding/json" consumers
+	var plain struct{ Name string }
+	require.NoError(t, json.Unmarshal(b, &plain))
+	require.Equal(t, "x", plain.Name)
+
+	t.Run("canonical", func(t *testing.T) {
+		b, err := MarshalCanonical(obj, typeIDHandler, WithFormatMarker("__polyjson"))
+		require.NoError(t, err)
+		require.Equal(t, `{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"Name":"x","__polyjson":"1"}`, string(b))
+	})
+
+	t.Run("map", func(t *testing.T) {
+		obj := map[string]any{"a": CalculatorLinear{K: 2}}
+		b, err := MarshalWithTypeIDs(obj, typeIDHandler, WithFormatMarker("__polyjson"))
+		require.NoError(t, err)
+
+		var cpy map[string]any
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithFormatMarker("__polyjson")))
+		require.Equal(t, obj, cpy)
+
+		b, err = MarshalWithTypeIDs(map[string]any{}, typeIDHandler, WithFormatMarker("__polyjson"))
+		require.NoError(t, err)
+		require.Equal(t, `{"__polyjson":"1"}`, string(b))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, doc := range []string{
+			`{"Name":"x"}`,
+			`{"__polyjson":"2","Name":"x"}`,
+			`{"__polyjson":1,"Name":"x"}`,
+			`[]`,
+		} {
+			var cpy document
+			err := UnmarshalWithTypeIDs([]byte(doc), &cpy, typeIDHandler, WithFormatMarker("__polyjson"))
+			require.ErrorAs(t, err, &ErrUnsupportedFormatVersion{}, doc)
+		}
+
+		_, err := MarshalWithTypeIDs([]int{1}, typeIDHandler, WithFormatMarker("__polyjson"))
+		require.Error(t, err)
+		_, err = MarshalWithTypeIDs(map[string]int{"__polyjson": 1}, typeIDHandler, WithFormatMarker("__polyjson"))
+		require.Error(t, err)
+	})
+}
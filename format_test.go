@@ -0,0 +1,64 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type tupleSample struct {
+	Calculator  Calculator
+	Calculators []Calculator
+	Dict        map[string]any
+	Nil         Calculator
+}
+
+func TestFormatTupleArray(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	obj := tupleSample{
+		Calculator:  CalculatorLinear{K: 1},
+		Calculators: []Calculator{&CalculatorConst{C: 2}},
+		Dict:        map[string]any{"a": CalculatorLinear{K: 3}},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler, WithFormat(FormatTupleArray))
+	require.NoError(t, err)
+	require.Equal(t, `{`+
+		`"Calculator":["github.com/xaionaro-go/polyjson.CalculatorLinear",{"K":1}],`+
+		`"Calculators":[["*github.com/xaionaro-go/polyjson.CalculatorConst",{"C":2}]],`+
+		`"Dict":{"a":["github.com/xaionaro-go/polyjson.CalculatorLinear",{"K":3}]},`+
+		`"Nil":null}`, string(b))
+
+	var cpy tupleSample
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithFormat(FormatTupleArray)))
+	require.Equal(t, obj, cpy)
+
+	t.Run("default_format", func(t *testing.T) {
+		err := UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+		require.ErrorAs(t, err, &ErrNotTypeTagged{})
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, doc := range []string{
+			`{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}}`,
+			`{"Calculator":["github.com/xaionaro-go/polyjson.CalculatorLinear"]}`,
+			`{"Calculator":["github.com/xaionaro-go/polyjson.CalculatorLinear",{"K":1},{}]}`,
+			`{"Calculator":[1,{"K":1}]}`,
+		} {
+			var cpy tupleSample
+			err := UnmarshalWithTypeIDs([]byte(doc), &cpy, typeIDHandler, WithFormat(FormatTupleArray))
+			require.Error(t, err, doc)
+		}
+	})
+}
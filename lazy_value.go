@@ -0,0 +1,78 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"encoding/json"
+)
+
+// LazyValue is a type-tagged value (`{TypeID:content}`), which decoding
+// is deferred until it is needed (see Resolve). It allows to skip expensive
+// or rarely accessed polymorphic subtrees of a document:
+//
+//	type Event struct {
+//	    Kind    string
+//	    Payload polyjson.LazyValue
+//	}
+//
+// The raw bytes are stored on unmarshal and put as is on marshal.
+type LazyValue struct {
+	raw json.RawMessage
+}
+
+var (
+	_ json.Marshaler   = LazyValue{}
+	_ json.Unmarshaler = (*LazyValue)(nil)
+)
+
+// NewLazyValue returns a LazyValue holding the value marshaled with its TypeID.
+func NewLazyValue(value any, typeIDOfer TypeIDOfer, opts ...Option) (LazyValue, error) {
+	m := &marshaler{
+		typeIDOfer: typeIDOfer,
+		config:     Options(opts).config(),
+	}
+	b, err := m.marshalAny(value, nil)
+	if err != nil {
+		return LazyValue{}, err
+	}
+	return LazyValue{raw: b}, nil
+}
+
+// Raw returns the stored JSON of the value.
+func (v LazyValue) Raw() json.RawMessage {
+	return v.raw
+}
+
+// Resolve decodes the stored value (see UnmarshalValue).
+//
+// An empty LazyValue (for example, the field was absent in the document)
+// is resolved to nil.
+func (v LazyValue) Resolve(newByTypeIDer NewByTypeIDer, opts ...Option) (any, error) {
+	if len(v.raw) == 0 {
+		return nil, nil
+	}
+	return UnmarshalValue(v.raw, newByTypeIDer, opts...)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v LazyValue) MarshalJSON() ([]byte, error) {
+	if len(v.raw) == 0 {
+		return []byte("null"), nil
+	}
+	return v.raw, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *LazyValue) UnmarshalJSON(b []byte) error {
+	v.raw = append(v.raw[:0], b...)
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazyValue(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type event struct {
+		Kind    string
+		Payload LazyValue
+	}
+
+	payload, err := NewLazyValue(&CalculatorConst{C: 2}, typeIDHandler)
+	require.NoError(t, err)
+	b, err := MarshalWithTypeIDs(event{Kind: "calc", Payload: payload}, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Kind":"calc","Payload":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}}}`, string(b))
+
+	// the payload is not resolved by the outer decoding, so an unknown TypeID is not an error
+	var unresolved event
+	require.NoError(t, UnmarshalWithTypeIDs([]byte(`{"Kind":"unknown","Payload":{"unknown":{"A":1}}}`), &unresolved, typeIDHandler))
+	require.Equal(t, `{"unknown":{"A":1}}`, string(unresolved.Payload.Raw()))
+	_, err = unresolved.Payload.Resolve(typeIDHandler)
+	require.Error(t, err)
+
+	var cpy event
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+	require.Equal(t, "calc", cpy.Kind)
+	value, err := cpy.Payload.Resolve(typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, &CalculatorConst{C: 2}, value)
+
+	value, err = LazyValue{}.Resolve(typeIDHandler)
+	require.NoError(t, err)
+	require.Nil(t, value)
+}
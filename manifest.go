@@ -0,0 +1,68 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"reflect"
+)
+
+// ManifestEntry is a single registered TypeID (see Manifest).
+type ManifestEntry struct {
+	// TypeID is the registered TypeID (or an alias).
+	TypeID TypeID
+
+	// GoType is the Go type the TypeID is resolved to, qualified
+	// by the full package path.
+	GoType string
+
+	// AliasOf is the primary TypeID of the type if TypeID is
+	// an alias (see RegisterTypeAlias).
+	AliasOf TypeID `json:",omitempty"`
+}
+
+// Manifest returns all the registered TypeIDs (including aliases)
+// sorted by TypeID, so that the result (for example, marshaled with
+// json.MarshalIndent) is byte-reproducible across runs and may be kept
+// under version control to track changes of the registry.
+func Manifest() []ManifestEntry {
+	registered := typeRegistry.TypeIDs()
+	result := make([]ManifestEntry, 0, len(registered))
+	for _, typeID := range registered {
+		if t, ok := typeRegistry[typeID]; ok {
+			result = append(result, ManifestEntry{
+				TypeID: typeID,
+				GoType: qualifiedTypeName(t),
+			})
+			continue
+		}
+		t := typeAliases[typeID]
+		primaryTypeID, ok := typeIDs[t]
+		if !ok {
+			primaryTypeID = typeToID(t)
+		}
+		result = append(result, ManifestEntry{
+			TypeID:  typeID,
+			GoType:  qualifiedTypeName(t),
+			AliasOf: primaryTypeID,
+		})
+	}
+	return result
+}
+
+// qualifiedTypeName returns the name of the type qualified by the full
+// package path (for example "github.com/xaionaro-go/polyjson.CalculatorLinear").
+func qualifiedTypeName(t reflect.Type) string {
+	if t.Name() == "" || t.PkgPath() == "" {
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
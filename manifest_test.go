@@ -0,0 +1,49 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(CalculatorLinear{})
+	RegisterTypeAlias("./legacy.CalculatorLinear", CalculatorLinear{})
+
+	manifest := Manifest()
+	require.True(t, sort.SliceIsSorted(manifest, func(i, j int) bool {
+		return manifest[i].TypeID < manifest[j].TypeID
+	}))
+	require.Contains(t, manifest, ManifestEntry{
+		TypeID: "CalculatorLinear",
+		GoType: "github.com/xaionaro-go/polyjson.CalculatorLinear",
+	})
+	require.Contains(t, manifest, ManifestEntry{
+		TypeID:  "./legacy.CalculatorLinear",
+		GoType:  "github.com/xaionaro-go/polyjson.CalculatorLinear",
+		AliasOf: "CalculatorLinear",
+	})
+
+	// byte-reproducible
+	b, err := json.MarshalIndent(manifest, "", " ")
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		again, err := json.MarshalIndent(Manifest(), "", " ")
+		require.NoError(t, err)
+		require.Equal(t, string(b), string(again))
+	}
+}
@@ -14,10 +14,17 @@
 package polyjson
 
 import (
+	"bytes"
+	"cmp"
+	"encoding"
 	"encoding/json"
 	"fmt"
 	"reflect"
-	"strings"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
 )
 
 // TypeID is an unique identifier of a type
@@ -41,6 +48,31 @@ type TypeIDHandler interface {
 	NewByTypeIDer
 }
 
+// TypeIDOferFunc is an adapter to use an ordinary function as a TypeIDOfer.
+type TypeIDOferFunc func(sample any) (TypeID, error)
+
+// TypeIDOf implements TypeIDOfer.
+func (fn TypeIDOferFunc) TypeIDOf(sample any) (TypeID, error) {
+	return fn(sample)
+}
+
+// NewByTypeIDerFunc is an adapter to use an ordinary function (for example,
+// a type switch) as a NewByTypeIDer:
+//
+//	polyjson.NewByTypeIDerFunc(func(typeID polyjson.TypeID) (any, error) {
+//	    switch typeID {
+//	    case "linear":
+//	        return &CalculatorLinear{}, nil
+//	    }
+//	    return nil, polyjson.ErrTypeIDNotRegistered{TypeID: typeID}
+//	})
+type NewByTypeIDerFunc func(typeID TypeID) (any, error)
+
+// NewByTypeID implements NewByTypeIDer.
+func (fn NewByTypeIDerFunc) NewByTypeID(typeID TypeID) (any, error) {
+	return fn(typeID)
+}
+
 // MarshalWithTypeIDs is similar to json.Marshal, but any interface field
 // met in a structure is serialized as a structure containing the type
 // identifier and the value. It allows to unmarshal the result without
@@ -64,16 +96,130 @@ type TypeIDHandler interface {
 //
 //	{"Field": {"Struct": {"Field": {"int": 1}}}}
 //
+// The output is deterministic: the keys of structures and maps are sorted
+// at every level (including nested maps and TypeID wrappers), so equal
+// values produce byte-identical documents. The output is compact, including
+// the content produced by custom marshalers (see also MarshalIndentWithTypeIDs).
+//
+// The fields of a structure tagged with `polyjson:"order=N"` are put first,
+// sorted by N, followed by the rest of the fields (sorted, or in the order
+// of declaration, see WithStdlibKeyOrder). It allows, for example, to put
+// the important fields first in a human-readable config.
+//
+// An embedded interface (for example `struct{ Calculator }`) is an ordinary
+// interface field named after the interface type: {"Calculator":{TypeID:...}}.
+// Same as in "encoding/json", the fields of its value are not promoted
+// (and an embedded interface of an unexported type is skipped).
+//
+// In addition to the standard "omitempty", the structure field tag option
+// "omitemptydeep" omits also an interface field holding the zero value
+// of its concrete type (or a pointer to it, for example &Struct{}). It costs
+// a comparison of the whole concrete value with zero for every such field.
+//
+// The structure field tag option "skipunknown" omits an interface field
+// if the TypeIDOfer fails to resolve the TypeID of its concrete
+// type (instead of failing the whole document), for example for best-effort
+// diagnostic dumps. It does not apply to values nested into the field.
+//
 // NOTE! This is not a drop-in replacement for standard json.Marshal.
 //
 //	It has incompatible behavior.
-func MarshalWithTypeIDs(obj any, typeIDOfer TypeIDOfer) ([]byte, error) {
-	return marshal(reflect.ValueOf(obj), typeIDOfer)
+func MarshalWithTypeIDs(obj any, typeIDOfer TypeIDOfer, opts ...Option) ([]byte, error) {
+	m := &marshaler{
+		typeIDOfer: typeIDOfer,
+		config:     Options(opts).config(),
+	}
+	b, err := m.marshal(reflect.ValueOf(obj), nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.addFormatMarker(b)
+}
+
+// MarshalValue is the same as MarshalWithTypeIDs, but accepts the value
+// as a reflect.Value (for example, obtained from an own reflection pipeline).
+//
+// If v is of an interface kind (for example, a structure field of an
+// interface type), then the value is wrapped with its TypeID, the same
+// as a pointer to an interface passed to MarshalWithTypeIDs.
+func MarshalValue(v reflect.Value, typeIDOfer TypeIDOfer, opts ...Option) ([]byte, error) {
+	m := &marshaler{
+		typeIDOfer: typeIDOfer,
+		config:     Options(opts).config(),
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if v.Kind() == reflect.Interface {
+		b, err = m.marshalTyped(v, nil)
+	} else {
+		b, err = m.marshal(v, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.addFormatMarker(b)
+}
+
+// MarshalIndentWithTypeIDs is the same as MarshalWithTypeIDs, but the
+// output is indented (the same as by json.MarshalIndent), including the
+// content produced by custom marshalers.
+func MarshalIndentWithTypeIDs(obj any, typeIDOfer TypeIDOfer, prefix, indent string, opts ...Option) ([]byte, error) {
+	b, err := MarshalWithTypeIDs(obj, typeIDOfer, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, prefix, indent); err != nil {
+		return nil, fmt.Errorf("unable to indent the document: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// MustMarshalWithTypeIDs is the same as MarshalWithTypeIDs, but panics on an error.
+//
+// It is intended for initialization code and tests, where an error is a programmer error.
+func MustMarshalWithTypeIDs(obj any, typeIDOfer TypeIDOfer, opts ...Option) []byte {
+	b, err := MarshalWithTypeIDs(obj, typeIDOfer, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var (
+	stringNull        = []byte("null")
+	stringEmptyObject = []byte("{}")
+)
+
+// truncatedMarker replaces the content deeper than the maximal depth (see MarshalWithTypeIDsMaxDepth).
+var truncatedMarker = []byte(`{"__truncated__":true}`)
+
+// MarshalWithTypeIDsMaxDepth is similar to MarshalWithTypeIDs, but
+// marshals only up to the given nesting depth: every structure, map, slice
+// or array nested deeper is replaced with {"__truncated__":true}
+// (TypeID wrappers are preserved). For example, with depth 1 only
+// the fields of the root value are marshaled, and only scalar ones
+// are marshaled completely.
+//
+// It is intended for previews and logging of large values.
+func MarshalWithTypeIDsMaxDepth(obj any, typeIDOfer TypeIDOfer, depth int, opts ...Option) ([]byte, error) {
+	return MarshalWithTypeIDs(obj, typeIDOfer, append(opts, optionMaxDepth(depth))...)
 }
 
-var stringNull = []byte("null")
+// marshaler contains the state of a single MarshalWithTypeIDs call.
+type marshaler struct {
+	typeIDOfer TypeIDOfer
+	config
+
+	// typeIDErrorHandler (if set) is called when unable to get a TypeID
+	// of a value. If it returns nil, then the value is put without
+	// the TypeID and the marshaling continues.
+	typeIDErrorHandler func(path valuePath, err error) error
+}
 
-func marshal(v reflect.Value, typeIDOfer TypeIDOfer) ([]byte, error) {
+func (m *marshaler) marshal(v reflect.Value, path valuePath) ([]byte, error) {
 	// How the function works:
 	//
 	// We are interested only about structures (and their fields),
@@ -82,30 +228,71 @@ func marshal(v reflect.Value, typeIDOfer TypeIDOfer) ([]byte, error) {
 	// We just iterate through fields and add TypeIDs if see an interface,
 	// otherwise marshal as is.
 
+	if !v.IsValid() {
+		// an untyped nil
+		return m.marshalNil()
+	}
+	if v.Type() == rawMessageType {
+		// embedding the pre-serialized sub-document verbatim (for example,
+		// a fragment produced by MarshalWithTypeIDs)
+		return marshalRawMessage(json.RawMessage(v.Bytes()))
+	}
+	if v.Type() == numberType {
+		return marshalNumber(json.Number(v.String()))
+	}
+	if isMarshalerLeaf(v.Type()) {
+		if !v.CanAddr() {
+			// the methods may be defined for the pointer (for example, in big.Int)
+			ptr := reflect.New(v.Type())
+			ptr.Elem().Set(v)
+			v = ptr.Elem()
+		}
+		return json.Marshal(v.Addr().Interface())
+	}
+	if m.HasMaxDepth && len(path) >= m.MaxDepth && isComposite(v.Type()) {
+		return truncatedMarker, nil
+	}
+
 	switch v.Kind() {
 	case reflect.Interface:
 		// unwrapping the interface
 		v := reflect.ValueOf(v.Interface())
 		if !v.IsValid() {
 			// there was the untyped nil value behind the interface
-			return stringNull, nil
+			return m.marshalNil()
 		}
-		return marshal(v, typeIDOfer)
+		return m.marshal(v, path)
 	case reflect.Pointer:
 		v := v.Elem()
 		if !v.IsValid() {
 			// is a nil pointer
-			return stringNull, nil
+			return m.marshalNil()
+		}
+		if v.Kind() == reflect.Interface {
+			// A pointer to an interface, the interface value requires the TypeID.
+			return m.marshalTyped(v, path)
 		}
 		// A pointer may lead to a structure, dereferencing and going deeper.
-		return marshal(v, typeIDOfer)
+		return m.marshal(v, path)
 	case reflect.Map:
+		if v.IsNil() {
+			// the same as "encoding/json" does: "null" vs "{}"
+			return m.marshalNil()
+		}
+		if v.Type() == mapStringAnyType {
+			// the most common shape of dynamic documents
+			return m.marshalMapStringAny(v.Interface().(map[string]any), path)
+		}
+
 		// marshaledFields contains the map of JSON field name to marshalled valued
-		marshaledFields := map[string]any{}
+		marshaledFields := map[string]json.RawMessage{}
 		iterator := v.MapRange()
 		for iterator.Next() {
 			key := iterator.Key()
 			value := iterator.Value()
+			if m.omitNil(value) {
+				continue
+			}
 
 			// Constructing the field name
 
@@ -116,37 +303,48 @@ func marshal(v reflect.Value, typeIDOfer TypeIDOfer) ([]byte, error) {
 
 			// Marshalling the content
 
-			b, err := marshal(value, typeIDOfer)
+			b, err := m.marshalTyped(value, path.Key(jsonFieldName))
 			if err != nil {
 				return nil, fmt.Errorf("unable to serialize value of map-entry with key '%s': %w", jsonFieldName, err)
 			}
+			marshaledFields[jsonFieldName] = b
+		}
+		return json.Marshal(marshaledFields)
+	case reflect.Slice, reflect.Array:
+		if !needsWalk(v.Type()) && !needsKeyOrdering(v.Type(), m.StdlibKeyOrder) &&
+			!m.HasMaxDepth && !m.HasNullRepresentation && m.FieldFilter == nil {
+			// nothing polymorphic inside, the standard marshaler is good enough
+			return json.Marshal(v.Interface())
+		}
 
-			// TODO: deduplicate the code below with the same code in the reflect.Struct case
-			// If the field is not interface, then putting the content directly
-			if v.Type().Elem().Kind() != reflect.Interface || !reflect.ValueOf(value.Interface()).IsValid() {
-				marshaledFields[jsonFieldName] = b
-				continue
-			}
-
-			// If the field is an interface, then put the value in format: {TypeID: {..Content..}}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			// Preserving the distinction between a nil slice and an empty one
+			// the same way as "encoding/json" does: "null" vs "[]".
+			return stringNull, nil
+		}
 
-			typeID, err := typeIDOfer.TypeIDOf(value.Interface())
+		items := make([]json.RawMessage, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			b, err := m.marshalTyped(v.Index(i), path.Index(i))
 			if err != nil {
-				return nil, fmt.Errorf("unable to get TypeID of %T: %w", value.Interface(), err)
-			}
-			marshaledFields[jsonFieldName] = map[TypeID]json.RawMessage{
-				typeID: json.RawMessage(b),
+				return nil, fmt.Errorf("unable to serialize item #%d of %s: %w", i, v.Type(), err)
 			}
+			items = append(items, b)
 		}
-		return json.Marshal(marshaledFields)
-	case reflect.Slice, reflect.Array:
-		// conversion for slices and arrays is not supported, yet
-		return json.Marshal(v.Interface())
+		return json.Marshal(items)
 	case reflect.Struct:
 		t := v.Type()
 
 		// marshaledFields contains the map of JSON field name to marshalled valued
-		marshaledFields := map[string]any{}
+		marshaledFields := map[string]json.RawMessage{}
+
+		// fieldNames contains the JSON field names in the order of declaration
+		// (see WithStdlibKeyOrder).
+		var fieldNames []string
+
+		// fieldOrders contains the explicit positions of the fields
+		// (see tag option `polyjson:"order=N"`).
+		var fieldOrders map[string]int
 
 		// Iterating through structure fields:
 		for i := 0; i < v.NumField(); i++ {
@@ -160,54 +358,386 @@ func marshal(v reflect.Value, typeIDOfer TypeIDOfer) ([]byte, error) {
 
 			// Detecting the field name
 
-			tag := fT.Tag.Get("json")
-			if tag == "-" {
+			tag, ok := parseFieldTag(fT)
+			if !ok {
 				// requested to skip
 				continue
 			}
-			tagWords := strings.Split(tag, ",")
-
-			jsonFieldName := fT.Name
-			if len(tagWords[0]) > 0 {
-				jsonFieldName = tagWords[0]
+			jsonFieldName := tag.Name
+			if tag.HasOption("omitempty") && isEmptyValue(fV) {
+				continue
+			}
+			if tag.HasOption("omitemptydeep") && isDeepEmptyValue(fV) {
+				continue
+			}
+			if tag.HasOption("skipunknown") && !m.hasTypeID(fV, path.Field(jsonFieldName)) {
+				continue
+			}
+			if m.omitNil(fV) {
+				continue
+			}
+			if m.FieldFilter != nil && !m.FieldFilter(path.Field(jsonFieldName).String(), fT) {
+				continue
 			}
 
 			// Marshalling the content
 
-			b, err := marshal(fV, typeIDOfer)
+			b, err := m.marshalTyped(fV, path.Field(jsonFieldName))
 			if err != nil {
 				return nil, fmt.Errorf("unable to serialize data within field #%d:%s of structure %T: %w", i, fT.Name, v.Interface(), err)
 			}
-
-			// If the field is not interface or it is an untyped nil, then putting the content directly
-			if fT.Type.Kind() != reflect.Interface || !reflect.ValueOf(fV.Interface()).IsValid() {
-				marshaledFields[jsonFieldName] = json.RawMessage(b)
-				continue
+			if isStringified(fT, tag) && !(fV.Kind() == reflect.Pointer && fV.IsNil()) {
+				// storing the scalar value as JSON inside a JSON string
+				b, err = json.Marshal(string(b))
+				if err != nil {
+					return nil, fmt.Errorf("unable to stringify the value of field #%d:%s of structure %T: %w", i, fT.Name, v.Interface(), err)
+				}
 			}
-
-			// If the field is an interface, then put the value in format: {TypeID: {..Content..}}
-
-			typeID, err := typeIDOfer.TypeIDOf(fV.Interface())
-			if err != nil {
-				return nil, fmt.Errorf("unable to get TypeID of %T: %w", fV.Interface(), err)
+			if _, ok := marshaledFields[jsonFieldName]; !ok {
+				fieldNames = append(fieldNames, jsonFieldName)
 			}
-			marshaledFields[jsonFieldName] = map[TypeID]json.RawMessage{
-				typeID: json.RawMessage(b),
+			marshaledFields[jsonFieldName] = b
+
+			if order, ok := parsePolyjsonTag(fT)["order"]; ok {
+				pos, err := strconv.Atoi(order)
+				if err != nil {
+					return nil, fmt.Errorf("invalid order '%s' of field #%d:%s of structure %T: %w", order, i, fT.Name, v.Interface(), err)
+				}
+				if fieldOrders == nil {
+					fieldOrders = map[string]int{}
+				}
+				fieldOrders[jsonFieldName] = pos
 			}
 		}
 
+		if m.StdlibKeyOrder || fieldOrders != nil {
+			return marshalObject(orderFields(fieldNames, fieldOrders, !m.StdlibKeyOrder), marshaledFields)
+		}
+
 		// Now we get the map of JSON field names to JSONized values. Just compiling this into the final JSON:
 		return json.Marshal(marshaledFields)
+	case reflect.Chan, reflect.Func:
+		// "encoding/json" does not support these as well, but we want to report where exactly the value is.
+		return nil, ErrUnsupportedType{Type: v.Type(), Path: path.String()}
 	}
 
 	// Everything else:
 	return json.Marshal(v.Interface())
 }
 
+// marshalMapStringAny is the same as marshal for a map[string]any,
+// but with less reflection.
+func (m *marshaler) marshalMapStringAny(obj map[string]any, path valuePath) ([]byte, error) {
+	omitNil := m.HasNullRepresentation && len(m.NullRepresentation) == 0
+	keys := make([]string, 0, len(obj))
+	for key, value := range obj {
+		if value == nil && omitNil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		b, err := m.marshalAny(obj[key], path.Key(key))
+		if err != nil {
+			return nil, fmt.Errorf("unable to serialize value of map-entry with key '%s': %w", key, err)
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSONString(&buf, key); err != nil {
+			return nil, fmt.Errorf("unable to serialize map key '%s': %w", key, err)
+		}
+		buf.WriteByte(':')
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// orderFields returns the field names (given in the order of declaration)
+// in the order to be emitted: the fields with explicit positions (see
+// tag option `polyjson:"order=N"`) first, sorted by the positions (and then
+// by the order of declaration), followed by the rest of the fields (sorted
+// by the names if sortRest is true).
+func orderFields(fieldNames []string, fieldOrders map[string]int, sortRest bool) []string {
+	var explicit, rest []string
+	for _, name := range fieldNames {
+		if _, ok := fieldOrders[name]; ok {
+			explicit = append(explicit, name)
+		} else {
+			rest = append(rest, name)
+		}
+	}
+	slices.SortStableFunc(explicit, func(a, b string) int {
+		return cmp.Compare(fieldOrders[a], fieldOrders[b])
+	})
+	if sortRest {
+		slices.Sort(rest)
+	}
+	return append(explicit, rest...)
+}
+
+// marshalObject returns the JSON object of the given fields
+// in the given order of the keys.
+func marshalObject(keys []string, fields map[string]json.RawMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSONString(&buf, key); err != nil {
+			return nil, fmt.Errorf("unable to serialize field name '%s': %w", key, err)
+		}
+		buf.WriteByte(':')
+		buf.Write(fields[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// writeJSONString writes the string as a JSON string, the same
+// as json.Marshal does, but avoiding its overhead for plain strings.
+func writeJSONString(buf *bytes.Buffer, s string) error {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= utf8.RuneSelf || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			// requires escaping
+			b, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			buf.Write(b)
+			return nil
+		}
+	}
+	buf.WriteByte('"')
+	buf.WriteString(s)
+	buf.WriteByte('"')
+	return nil
+}
+
+// marshalNil returns the representation of a nil value (see WithNullRepresentation).
+func (m *marshaler) marshalNil() ([]byte, error) {
+	if !m.HasNullRepresentation || len(m.NullRepresentation) == 0 {
+		return stringNull, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, m.NullRepresentation); err != nil {
+		return nil, fmt.Errorf("the null representation '%s' is not a valid JSON: %w", m.NullRepresentation, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// omitNil returns true if the value is a nil pointer, interface or map,
+// and it is requested to omit such values (see WithNullRepresentation).
+func (m *marshaler) omitNil(v reflect.Value) bool {
+	if !m.HasNullRepresentation || len(m.NullRepresentation) != 0 {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map:
+		return v.IsNil()
+	}
+	return false
+}
+
+// marshalTyped marshals the value and, if the value is an interface
+// (and not an untyped nil), puts the result in format: {TypeID: {..Content..}}.
+func (m *marshaler) marshalTyped(v reflect.Value, path valuePath) (json.RawMessage, error) {
+	if m.ErrorValues && v.Type() == errorType && !v.IsNil() {
+		return marshalError(v.Interface().(error))
+	}
+
+	b, err := m.marshal(v, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the value is not interface or it is an untyped nil, then returning the content directly
+	if v.Kind() != reflect.Interface || v.IsNil() {
+		return b, nil
+	}
+
+	if m.isUnwrapped(v, path) {
+		// the type is unambiguous, the TypeID is not required
+		return b, nil
+	}
+
+	return m.wrap(v.Interface(), b, path)
+}
+
+// isUnwrapped returns true if the value of the (non-nil) interface is put
+// without the TypeID wrapper (see WithMinimalWrapping). A TypeID forced
+// for the path (see WithForcedTypeID) is always put.
+func (m *marshaler) isUnwrapped(v reflect.Value, path valuePath) bool {
+	if !m.MinimalWrapping {
+		return false
+	}
+	if _, ok := m.ForcedTypeIDs[path.String()]; ok {
+		return false
+	}
+	impl, ok := m.soleImplementation(v.Type())
+	return ok && impl == v.Elem().Type()
+}
+
+// hasTypeID returns false if the value is a non-nil interface, which
+// concrete type has no TypeID (see tag option "skipunknown").
+func (m *marshaler) hasTypeID(v reflect.Value, path valuePath) bool {
+	if v.Kind() != reflect.Interface || v.IsNil() {
+		return true
+	}
+	if m.ErrorValues && v.Type() == errorType {
+		return true
+	}
+	if m.PlainScalars && isPlainScalarType(v.Elem().Type()) {
+		return true
+	}
+	if _, ok := m.ForcedTypeIDs[path.String()]; ok {
+		return true
+	}
+	if m.isUnwrapped(v, path) {
+		return true
+	}
+	_, err := m.typeIDOf(v.Interface())
+	return err == nil
+}
+
+// typeIDOf returns the TypeID of the value (see also WithPolyTypeFallback).
+func (m *marshaler) typeIDOf(obj any) (TypeID, error) {
+	typeID, err := m.typeIDOfer.TypeIDOf(obj)
+	if err != nil && m.PolyTypeFallback {
+		if polyTyper, ok := obj.(PolyTyper); ok {
+			return TypeID(polyTyper.PolyType()), nil
+		}
+	}
+	return typeID, err
+}
+
+// marshalAny is the same as marshalTyped for a value stored in an interface
+// of type "any", but without reflection of the interface itself.
+func (m *marshaler) marshalAny(obj any, path valuePath) (json.RawMessage, error) {
+	if obj == nil {
+		return m.marshalNil()
+	}
+
+	b, err := m.marshal(reflect.ValueOf(obj), path)
+	if err != nil {
+		return nil, err
+	}
+	return m.wrap(obj, b, path)
+}
+
+// wrap puts the marshaled content of the (non-nil) interface
+// value obj in format: {TypeID: {..Content..}}.
+func (m *marshaler) wrap(obj any, b []byte, path valuePath) (json.RawMessage, error) {
+	if m.HasEmptyContentMarker && bytes.Equal(b, stringEmptyObject) {
+		if err := checkEmptyContentMarker(m.EmptyContentMarker); err != nil {
+			return nil, err
+		}
+		b = m.EmptyContentMarker
+	}
+
+	if len(m.ForcedTypeIDs) != 0 {
+		if typeID, ok := m.ForcedTypeIDs[path.String()]; ok {
+			m.trace(path, typeID)
+			return m.marshalWrapper(typeID, b)
+		}
+	}
+
+	if m.PlainScalars && isPlainScalarType(reflect.TypeOf(obj)) {
+		// see WithPlainScalars
+		return b, nil
+	}
+
+	typeID, err := m.typeIDOf(obj)
+	if err != nil {
+		err = fmt.Errorf("unable to get TypeID of %T: %w", obj, err)
+		if m.typeIDErrorHandler == nil {
+			return nil, err
+		}
+		if err := m.typeIDErrorHandler(path, err); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	if m.PointerTypeIDs {
+		typeID = TypeID(pointerTypeIDPrefix(reflect.TypeOf(obj))) + typeID
+	}
+	m.trace(path, typeID)
+	return m.marshalWrapper(typeID, b)
+}
+
+// marshalWrapper returns {TypeID: {..Content..}}.
+//
+// It is constructed directly (instead of marshaling a single-entry map),
+// so the output is deterministic by construction.
+func marshalWrapper(typeID TypeID, content []byte) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(typeID) + len(content) + 5)
+	buf.WriteByte('{')
+	if err := writeJSONString(&buf, string(typeID)); err != nil {
+		return nil, fmt.Errorf("unable to serialize TypeID '%s': %w", typeID, err)
+	}
+	buf.WriteByte(':')
+	buf.Write(content)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalRawMessage emits the raw JSON as is (but compacted and with
+// HTML characters escaped, the same as "encoding/json" does).
+func marshalRawMessage(raw json.RawMessage) ([]byte, error) {
+	if raw == nil {
+		// the same as "encoding/json" does
+		return stringNull, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json.RawMessage '%s': %w", raw, err)
+	}
+	return b, nil
+}
+
+// marshalNumber emits the number literally (instead of a JSON string).
+func marshalNumber(n json.Number) ([]byte, error) {
+	if n == "" {
+		// the same as "encoding/json" does
+		return []byte("0"), nil
+	}
+	if !gjson.Valid(string(n)) || gjson.Parse(string(n)).Type != gjson.Number {
+		return nil, fmt.Errorf("invalid number literal '%s'", n)
+	}
+	return []byte(n), nil
+}
+
+// stringifyMapKey returns the JSON object key for the map key, using
+// the same rules as "encoding/json": strings are used as is, then
+// encoding.TextMarshaler is respected, and integers are formatted in decimal.
 func stringifyMapKey(mapKey reflect.Value) (string, error) {
 	if mapKey.Kind() == reflect.String {
 		return mapKey.String(), nil
 	}
+	if textMarshaler, ok := mapKey.Interface().(encoding.TextMarshaler); ok {
+		if mapKey.Kind() == reflect.Pointer && mapKey.IsNil() {
+			return "", nil
+		}
+		b, err := textMarshaler.MarshalText()
+		if err != nil {
+			return "", fmt.Errorf("unable to marshal map key '%#+v' (%T) as text: %w", mapKey.Interface(), mapKey.Interface(), err)
+		}
+		return string(b), nil
+	}
+	switch mapKey.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(mapKey.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(mapKey.Uint(), 10), nil
+	}
 
 	return "", fmt.Errorf("unable to stringify map key '%#+v' (%T)", mapKey.Interface(), mapKey.Interface())
 }
@@ -14,10 +14,13 @@ package polyjson
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -45,6 +48,26 @@ type Struct3 struct {
 	Int2 int
 }
 
+type Calculator interface {
+	Calculate(x float64) float64
+}
+
+type CalculatorLinear struct {
+	K float64
+}
+
+func (c CalculatorLinear) Calculate(x float64) float64 {
+	return c.K * x
+}
+
+type CalculatorConst struct {
+	C float64
+}
+
+func (c *CalculatorConst) Calculate(float64) float64 {
+	return c.C
+}
+
 type typeIDHandlerT struct{}
 
 func (typeIDHandlerT) TypeIDOf(sample any) (TypeID, error) {
@@ -86,6 +109,10 @@ func newByTypeID(typeID TypeID) any {
 		return &Struct2{}
 	case "github.com/xaionaro-go/polyjson.Struct3":
 		return &Struct3{}
+	case "github.com/xaionaro-go/polyjson.CalculatorLinear":
+		return &CalculatorLinear{}
+	case "github.com/xaionaro-go/polyjson.CalculatorConst":
+		return &CalculatorConst{}
 	case "github.com/xaionaro-go/polyjson.blob":
 		return &blob{}
 	case "int":
@@ -184,3 +211,974 @@ func TestMarshalUnmarshal(t *testing.T) {
 
 	require.Equal(t, testObj, cpy)
 }
+
+func TestMarshalNilVsEmptySlice(t *testing.T) {
+	type calculators struct {
+		Calculators []Calculator
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	for _, testCase := range []struct {
+		Name         string
+		Value        calculators
+		ExpectedJSON string
+	}{
+		{
+			Name:         "nil",
+			Value:        calculators{Calculators: nil},
+			ExpectedJSON: `{"Calculators":null}`,
+		},
+		{
+			Name:         "empty",
+			Value:        calculators{Calculators: []Calculator{}},
+			ExpectedJSON: `{"Calculators":[]}`,
+		},
+	} {
+		t.Run(testCase.Name, func(t *testing.T) {
+			b, err := MarshalWithTypeIDs(testCase.Value, typeIDHandler)
+			require.NoError(t, err)
+			require.Equal(t, testCase.ExpectedJSON, string(b))
+
+			var cpy calculators
+			err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+			require.NoError(t, err)
+			require.Equal(t, testCase.Value, cpy)
+		})
+	}
+}
+
+func TestMarshalUnsupportedType(t *testing.T) {
+	type withFunc struct {
+		Name     string
+		Callback func()
+	}
+	type withChan struct {
+		Items []any
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	_, err := MarshalWithTypeIDs(withFunc{Name: "a"}, typeIDHandler)
+	var errUnsupported ErrUnsupportedType
+	require.ErrorAs(t, err, &errUnsupported)
+	require.Equal(t, reflect.TypeOf(func() {}), errUnsupported.Type)
+	require.Equal(t, "$.Callback", errUnsupported.Path)
+
+	_, err = MarshalWithTypeIDs(withChan{Items: []any{1, make(chan int)}}, typeIDHandler)
+	require.ErrorAs(t, err, &errUnsupported)
+	require.Equal(t, reflect.TypeOf(make(chan int)), errUnsupported.Type)
+	require.Equal(t, "$.Items[1]", errUnsupported.Path)
+
+	_, err = MarshalWithTypeIDs(map[string]any{"cb": func() {}}, typeIDHandler)
+	require.ErrorAs(t, err, &errUnsupported)
+	require.Equal(t, `$["cb"]`, errUnsupported.Path)
+}
+
+func TestMarshalDeterministic(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	testObj := map[string]map[string]Calculator{}
+	for i := 0; i < 100; i++ {
+		testObj[fmt.Sprintf("key%d", i)] = map[string]Calculator{
+			"b": CalculatorLinear{K: float64(i)},
+			"a": &CalculatorConst{C: float64(i)},
+			"c": nil,
+		}
+	}
+
+	expected, err := MarshalWithTypeIDs(testObj, typeIDHandler)
+	require.NoError(t, err)
+	require.True(t, json.Valid(expected))
+	require.Contains(t, string(expected), `"key0":{"a":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":0}},"b":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":0}},"c":null}`)
+
+	for i := 0; i < 20; i++ {
+		b, err := MarshalWithTypeIDs(testObj, typeIDHandler)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(b))
+	}
+}
+
+type customError struct {
+	Code int
+}
+
+func (e customError) Error() string {
+	return fmt.Sprintf("code %d", e.Code)
+}
+
+func TestMarshalUnmarshalErrorValues(t *testing.T) {
+	type result struct {
+		Value int
+		Err   error
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	testObj := []result{
+		{Value: 1, Err: nil},
+		{Value: 2, Err: fmt.Errorf("wrapped: %w", customError{Code: 3})},
+	}
+
+	_, err := MarshalWithTypeIDs(testObj, TypeRegistry())
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+
+	b, err := MarshalWithTypeIDs(testObj, typeIDHandler, WithErrorValues(true))
+	require.NoError(t, err)
+	require.Equal(t, `[{"Err":null,"Value":1},{"Err":{"error":"wrapped: code 3"},"Value":2}]`, string(b))
+
+	var cpy []result
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithErrorValues(true))
+	require.NoError(t, err)
+	require.Len(t, cpy, 2)
+	require.NoError(t, cpy[0].Err)
+	require.EqualError(t, cpy[1].Err, "wrapped: code 3")
+	require.Equal(t, errors.New("wrapped: code 3"), cpy[1].Err)
+}
+
+type BigID int64
+
+func TestMarshalUnmarshalStringified(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterStringifiedNumberType(BigID(0))
+
+	type record struct {
+		ID       BigID
+		ParentID *BigID
+		Count    int  `json:",string"`
+		Enabled  bool `json:"enabled,string"`
+		Plain    int64
+		Limit    *int `json:",string"`
+	}
+	type records struct {
+		Records []record
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	testObj := records{
+		Records: []record{
+			{ID: 9007199254740993, Count: 2, Enabled: true, Plain: 3},
+		},
+	}
+
+	b, err := MarshalWithTypeIDs(testObj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Records":[{"Count":"2","ID":"9007199254740993","Limit":null,"ParentID":null,"Plain":3,"enabled":"true"}]}`, string(b))
+
+	var cpy records
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, testObj, cpy)
+
+	// pointers to scalars are stringified the same way
+	limit, parentID := 7, BigID(9007199254740995)
+	testObj.Records[0].Limit, testObj.Records[0].ParentID = &limit, &parentID
+	b, err = MarshalWithTypeIDs(testObj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Records":[{"Count":"2","ID":"9007199254740993","Limit":"7","ParentID":"9007199254740995","Plain":3,"enabled":"true"}]}`, string(b))
+	stdB, err := json.Marshal(struct {
+		Limit *int `json:",string"`
+	}{Limit: &limit})
+	require.NoError(t, err)
+	require.Equal(t, `{"Limit":"7"}`, string(stdB))
+
+	cpy = records{}
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, testObj, cpy)
+
+	// the string should contain exactly one scalar (as in "encoding/json"):
+	for field, value := range map[string]string{
+		"Count": `"42 abc"`,
+		"Limit": `"7 x"`,
+	} {
+		for _, value := range []string{value, `"4 2"`, `"42abc"`, `"[1]"`} {
+			doc := `{"` + field + `":` + value + `}`
+			var stdCpy struct {
+				Count int  `json:",string"`
+				Limit *int `json:",string"`
+			}
+			require.Error(t, json.Unmarshal([]byte(doc), &stdCpy), doc)
+
+			var cpy record
+			err := UnmarshalWithTypeIDs([]byte(doc), &cpy, typeIDHandler)
+			require.Error(t, err, doc)
+			require.Contains(t, err.Error(), value, doc)
+		}
+	}
+
+	// unquoted values are accepted as well:
+	cpy = records{}
+	err = UnmarshalWithTypeIDs([]byte(`{"Records":[{"ID":5,"Count":6}]}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, records{Records: []record{{ID: 5, Count: 6}}}, cpy)
+}
+
+func TestMarshalUnmarshalNumber(t *testing.T) {
+	type measurement struct {
+		Value  json.Number
+		Values map[string]json.Number
+		Any    any
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	testObj := measurement{
+		Value:  "123456789012345678901234567890.5",
+		Values: map[string]json.Number{"a": "1e100", "b": "-0.0"},
+	}
+
+	b, err := MarshalWithTypeIDs(testObj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Any":null,"Value":123456789012345678901234567890.5,"Values":{"a":1e100,"b":-0.0}}`, string(b))
+
+	var cpy measurement
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, testObj, cpy)
+
+	cpy = measurement{}
+	err = UnmarshalWithTypeIDs([]byte(`{"Value":"42"}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, json.Number("42"), cpy.Value)
+
+	err = UnmarshalWithTypeIDs([]byte(`{"Value":"forty two"}`), &cpy, typeIDHandler)
+	require.Error(t, err)
+
+	_, err = MarshalWithTypeIDs(measurement{Value: "1 2"}, typeIDHandler)
+	require.Error(t, err)
+}
+
+func TestMarshalUntypedNil(t *testing.T) {
+	b, err := MarshalWithTypeIDs(nil, typeIDHandlerT{})
+	require.NoError(t, err)
+	require.Equal(t, "null", string(b))
+}
+
+func TestMarshalWithTypeIDsMaxDepth(t *testing.T) {
+	type node struct {
+		Name     string
+		Children []node
+		Value    any
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	testObj := node{
+		Name: "root",
+		Children: []node{
+			{Name: "child", Children: []node{{Name: "grandchild"}}},
+		},
+		Value: Struct1{Int0: 1, Iface1: Struct3{Int2: 2}},
+	}
+
+	for _, testCase := range []struct {
+		Depth        int
+		ExpectedJSON string
+	}{
+		{
+			Depth:        0,
+			ExpectedJSON: `{"__truncated__":true}`,
+		},
+		{
+			Depth:        1,
+			ExpectedJSON: `{"Children":{"__truncated__":true},"Name":"root","Value":{"github.com/xaionaro-go/polyjson.Struct1":{"__truncated__":true}}}`,
+		},
+		{
+			Depth: 2,
+			ExpectedJSON: `{"Children":[{"__truncated__":true}],"Name":"root","Value":{"github.com/xaionaro-go/polyjson.Struct1":` +
+				`{"Iface1":{"github.com/xaionaro-go/polyjson.Struct3":{"__truncated__":true}},"Int1":null,"int":1}}}`,
+		},
+	} {
+		t.Run(fmt.Sprint(testCase.Depth), func(t *testing.T) {
+			b, err := MarshalWithTypeIDsMaxDepth(testObj, typeIDHandler, testCase.Depth)
+			require.NoError(t, err)
+			require.Equal(t, testCase.ExpectedJSON, string(b))
+		})
+	}
+
+	b, err := MarshalWithTypeIDsMaxDepth(testObj, typeIDHandler, 100)
+	require.NoError(t, err)
+	expected, err := MarshalWithTypeIDs(testObj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(b))
+}
+
+func TestMarshalValue(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	obj := Strategy{Name: "const", Calculator: &CalculatorConst{C: 1}}
+
+	b, err := MarshalValue(reflect.ValueOf(obj), typeIDHandler)
+	require.NoError(t, err)
+	expected, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(b))
+
+	// a value of an interface kind keeps its TypeID
+	b, err = MarshalValue(reflect.ValueOf(obj).FieldByName("Calculator"), typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":1}}`, string(b))
+}
+
+type stdlibTagged struct {
+	Calculator Calculator      `json:",omitempty"`
+	Plain      int             `json:",omitempty"`
+	Renamed    string          `json:"renamed"`
+	Skipped    int             `json:"-"`
+	Dash       int             `json:"-,"`
+	Punct      int             `json:"#$%"`
+	Empty      []int           `json:"empty,omitempty"`
+	NilPtr     *int            `json:"nilPtr,omitempty"`
+	Struct     CalculatorConst `json:"struct,omitempty"`
+}
+
+func TestMarshalUnmarshalStdlibTags(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	// with a nil interface the output should be exactly the same as of "encoding/json"
+	obj := stdlibTagged{Renamed: "r", Skipped: 1, Dash: 2, Punct: 4, Empty: []int{}}
+	expected, err := json.Marshal(obj)
+	require.NoError(t, err)
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expected), string(b))
+	require.Equal(t, `{"#$%":4,"-":2,"renamed":"r","struct":{"C":0}}`, string(b))
+
+	obj = stdlibTagged{Calculator: CalculatorLinear{K: 1}, Plain: 5, Dash: 2}
+	b, err = MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"#$%":0,"-":2,"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"Plain":5,"renamed":"","struct":{"C":0}}`, string(b))
+
+	var cpy stdlibTagged
+	err = UnmarshalWithTypeIDs([]byte(`{"-":2,"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"Plain":5,"Skipped":7}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+
+	// an invalid name falls back to the name of the field
+	b, err = MarshalWithTypeIDs(struct {
+		Calculator Calculator
+		Invalid    int `json:"a'b,omitempty"`
+	}{Invalid: 1}, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":null,"Invalid":1}`, string(b))
+}
+
+func TestMarshalUnmarshalBigNumbers(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(big.Int{})
+	RegisterType(big.Rat{})
+
+	type amounts struct {
+		Ptr   *big.Int
+		Value big.Int
+		Rat   big.Rat
+		Iface any
+		Rates []any
+	}
+	huge, ok := new(big.Int).SetString("123456789012345678901234567890", 10)
+	require.True(t, ok)
+	obj := amounts{
+		Ptr:   huge,
+		Value: *big.NewInt(-42),
+		Rat:   *big.NewRat(1, 3),
+		Iface: *big.NewInt(7),
+		Rates: []any{*big.NewRat(-5, 2)},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"Iface":{"math/big.Int":7},"Ptr":123456789012345678901234567890,"Rat":"1/3","Rates":[{"math/big.Rat":"-5/2"}],"Value":-42}`, string(b))
+
+	var cpy amounts
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, huge.String(), cpy.Ptr.String())
+	require.Equal(t, "-42", cpy.Value.String())
+	require.Equal(t, "1/3", cpy.Rat.String())
+	ifaceInt, ok := cpy.Iface.(big.Int)
+	require.True(t, ok)
+	require.Equal(t, "7", ifaceInt.String())
+	require.Len(t, cpy.Rates, 1)
+	ifaceRat, ok := cpy.Rates[0].(big.Rat)
+	require.True(t, ok)
+	require.Equal(t, "-5/2", ifaceRat.String())
+}
+
+func TestMarshalWithNullRepresentation(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type nils struct {
+		Calculator Calculator
+		Ptr        *int
+		Map        map[string]int
+		Items      []Calculator
+	}
+	obj := nils{Items: []Calculator{nil, CalculatorLinear{K: 1}}}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler, WithNullRepresentation(json.RawMessage(`{"$null":true}`)))
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":{"$null":true},"Items":[{"$null":true},{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}],"Map":{"$null":true},"Ptr":{"$null":true}}`, string(b))
+
+	b, err = MarshalWithTypeIDs(obj, typeIDHandler, WithNullRepresentation(nil))
+	require.NoError(t, err)
+	require.Equal(t, `{"Items":[null,{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}]}`, string(b))
+
+	b, err = MarshalWithTypeIDs(map[string]*int{"a": nil, "b": new(int)}, typeIDHandler, WithNullRepresentation(nil))
+	require.NoError(t, err)
+	require.Equal(t, `{"b":0}`, string(b))
+
+	_, err = MarshalWithTypeIDs(obj, typeIDHandler, WithNullRepresentation(json.RawMessage(`{`)))
+	require.Error(t, err)
+}
+
+type indentedCalculator struct{}
+
+func (indentedCalculator) Calculate(x float64) float64 { return x }
+
+func (indentedCalculator) MarshalJSON() ([]byte, error) {
+	return []byte("{\n\t\"K\": [ 1,\n\t\t2 ]\n}"), nil
+}
+
+func (*indentedCalculator) UnmarshalJSON([]byte) error { return nil }
+
+func TestMarshalCompactsNestedContent(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type doc struct {
+		Strategy Strategy
+		Items    []Calculator
+		Raw      json.RawMessage
+	}
+	obj := doc{
+		Strategy: Strategy{Calculator: indentedCalculator{}},
+		Items:    []Calculator{indentedCalculator{}},
+		Raw:      json.RawMessage("[ 1 ,\n 2 ]"),
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler, WithNullRepresentation(json.RawMessage(" { \"$null\" : 1 } ")))
+	require.NoError(t, err)
+	require.Equal(t, `{"Items":[{"github.com/xaionaro-go/polyjson.indentedCalculator":{"K":[1,2]}}],"Raw":[1,2],"Strategy":{"Calculator":{"github.com/xaionaro-go/polyjson.indentedCalculator":{"K":[1,2]}},"Name":""}}`, string(b))
+
+	b, err = MarshalWithTypeIDs(&[]Calculator{nil}[0], typeIDHandler, WithNullRepresentation(json.RawMessage(" { \"$null\" : 1 } ")))
+	require.NoError(t, err)
+	require.Equal(t, `{"$null":1}`, string(b))
+
+	b, err = MarshalIndentWithTypeIDs(&obj.Strategy, typeIDHandler, "", "  ")
+	require.NoError(t, err)
+	require.Equal(t, `{
+  "Calculator": {
+    "github.com/xaionaro-go/polyjson.indentedCalculator": {
+      "K": [
+        1,
+        2
+      ]
+    }
+  },
+  "Name": ""
+}`, string(b))
+}
+
+func TestMarshalWithFieldFilter(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type credentials struct {
+		User     string
+		Password string `json:"password" redact:"true"`
+		Hint     string `json:",omitempty" redact:"true"`
+	}
+	type account struct {
+		Credentials []credentials
+		Calculator  Calculator
+		Skipped     string `json:"-"`
+	}
+	obj := account{
+		Credentials: []credentials{{User: "u", Password: "p"}},
+		Calculator:  CalculatorLinear{K: 1},
+		Skipped:     "s",
+	}
+
+	var paths []string
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler, WithFieldFilter(func(path string, field reflect.StructField) bool {
+		paths = append(paths, path)
+		return field.Tag.Get("redact") != "true"
+	}))
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"Credentials":[{"User":"u"}]}`, string(b))
+	require.ElementsMatch(t, []string{
+		"$.Credentials",
+		"$.Credentials[0].User",
+		"$.Credentials[0].password",
+		"$.Calculator",
+		"$.Calculator.K",
+	}, paths)
+}
+
+func TestMarshalWithForcedTypeID(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type pipeline struct {
+		Calculators []Calculator
+	}
+	obj := pipeline{
+		Calculators: []Calculator{CalculatorLinear{K: 1}, CalculatorLinear{K: 2}},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler, WithForcedTypeID("$.Calculators[1]", "LegacyLinear"))
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculators":[{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},{"LegacyLinear":{"K":2}}]}`, string(b))
+
+	t.Run("minimal_wrapping", func(t *testing.T) {
+		isolateTypeRegistry(t)
+		RegisterType(soleImpl{})
+		type doc struct {
+			Soles []soleIface
+		}
+		obj := doc{Soles: []soleIface{&soleImpl{A: 1}, &soleImpl{A: 2}}}
+		b, err := MarshalWithTypeIDs(obj, TypeRegistry(), WithMinimalWrapping(true), WithForcedTypeID("$.Soles[1]", "soleImpl"))
+		require.NoError(t, err)
+		require.Equal(t, `{"Soles":[{"A":1},{"soleImpl":{"A":2}}]}`, string(b))
+
+		var cpy doc
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, TypeRegistry(), WithMinimalWrapping(true)))
+		require.Equal(t, obj, cpy)
+	})
+}
+
+func TestTypeIDHandlerFuncs(t *testing.T) {
+	typeIDOfer := TypeIDOferFunc(func(sample any) (TypeID, error) {
+		switch sample.(type) {
+		case CalculatorLinear:
+			return "linear", nil
+		case *CalculatorConst:
+			return "const", nil
+		}
+		return "", fmt.Errorf("unexpected type %T", sample)
+	})
+	newByTypeIDer := NewByTypeIDerFunc(func(typeID TypeID) (any, error) {
+		switch typeID {
+		case "linear":
+			return &CalculatorLinear{}, nil
+		case "const":
+			return &CalculatorConst{}, nil
+		}
+		return nil, ErrTypeIDNotRegistered{TypeID: typeID}
+	})
+
+	obj := []Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}}
+	b, err := MarshalWithTypeIDs(obj, typeIDOfer)
+	require.NoError(t, err)
+	require.Equal(t, `[{"linear":{"K":1}},{"const":{"C":2}}]`, string(b))
+
+	var cpy []Calculator
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, newByTypeIDer))
+	require.Equal(t, obj, cpy)
+
+	err = UnmarshalWithTypeIDs([]byte(`[{"unknown":{}}]`), &cpy, newByTypeIDer)
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+}
+
+func benchmarkMapStringAny() map[string]any {
+	m := make(map[string]any, 1000)
+	for i := 0; i < 1000; i++ {
+		switch i % 3 {
+		case 0:
+			m[fmt.Sprintf("k%d", i)] = CalculatorLinear{K: float64(i)}
+		case 1:
+			m[fmt.Sprintf("k%d", i)] = &CalculatorConst{C: float64(i)}
+		default:
+			m[fmt.Sprintf("k%d", i)] = nil
+		}
+	}
+	return m
+}
+
+func BenchmarkMarshalMapStringAny(b *testing.B) {
+	typeIDHandler := typeIDHandlerT{}
+	obj := benchmarkMapStringAny()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := MarshalWithTypeIDs(obj, typeIDHandler); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalMapStringAny(b *testing.B) {
+	typeIDHandler := typeIDHandlerT{}
+	doc, err := MarshalWithTypeIDs(benchmarkMapStringAny(), typeIDHandler)
+	require.NoError(b, err)
+	b.ReportAllocs()
+	for b.Loop() {
+		var cpy map[string]any
+		if err := UnmarshalWithTypeIDs(doc, &cpy, typeIDHandler); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMarshalOmitEmptyDeep(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type config struct {
+		Default  Calculator `json:",omitemptydeep"`
+		Pointer  Calculator `json:",omitemptydeep"`
+		Nil      Calculator `json:",omitemptydeep"`
+		Set      Calculator `json:",omitemptydeep"`
+		Shallow  Calculator `json:",omitempty"`
+		Name     string     `json:",omitemptydeep"`
+		Explicit Calculator
+	}
+	obj := config{
+		Default:  CalculatorLinear{},
+		Pointer:  &CalculatorConst{},
+		Set:      CalculatorLinear{K: 1},
+		Shallow:  CalculatorLinear{},
+		Explicit: CalculatorLinear{},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Explicit":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":0}},"Set":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"Shallow":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":0}}}`, string(b))
+}
+
+type markerCalculator struct{}
+
+func (markerCalculator) Calculate(x float64) float64 {
+	return x
+}
+
+type probeLevel int
+
+func (probeLevel) Calculate(x float64) float64 {
+	return x
+}
+
+func TestWithEmptyContentMarker(t *testing.T) {
+	newByTypeIDer := NewByTypeIDerFunc(func(typeID TypeID) (any, error) {
+		switch typeID {
+		case "marker":
+			return &markerCalculator{}, nil
+		case "level":
+			return new(probeLevel), nil
+		}
+		return typeIDHandlerT{}.NewByTypeID(typeID)
+	})
+	typeIDOfer := TypeIDOferFunc(func(sample any) (TypeID, error) {
+		switch sample.(type) {
+		case markerCalculator:
+			return "marker", nil
+		case probeLevel:
+			return "level", nil
+		}
+		return typeIDHandlerT{}.TypeIDOf(sample)
+	})
+	obj := []Calculator{markerCalculator{}, CalculatorLinear{K: 1}, (*CalculatorConst)(nil), probeLevel(0)}
+
+	for marker, expected := range map[string]string{
+		"[]":  `[{"marker":[]},{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},{"*github.com/xaionaro-go/polyjson.CalculatorConst":null},{"level":0}]`,
+		"[0]": `[{"marker":[0]},{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},{"*github.com/xaionaro-go/polyjson.CalculatorConst":null},{"level":0}]`,
+	} {
+		opt := WithEmptyContentMarker(json.RawMessage(marker))
+		b, err := MarshalWithTypeIDs(obj, typeIDOfer, opt)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(b))
+
+		var cpy []Calculator
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, newByTypeIDer, opt))
+		require.Equal(t, obj, cpy, marker)
+	}
+
+	// the scalar content equal to the marker is not replaced
+	var level Calculator
+	err := UnmarshalWithTypeIDs([]byte(`{"level":[]}`), &level, newByTypeIDer, WithEmptyContentMarker(json.RawMessage("[]")))
+	require.Error(t, err)
+
+	b, err := MarshalWithTypeIDs(obj[:1], typeIDOfer)
+	require.NoError(t, err)
+	require.Equal(t, `[{"marker":{}}]`, string(b))
+
+	// markers, which could be confused with scalar content, are rejected
+	for _, marker := range []string{"0", "null", `"empty"`, `{"empty":true}`} {
+		opt := WithEmptyContentMarker(json.RawMessage(marker))
+		_, err := MarshalWithTypeIDs(obj[:1], typeIDOfer, opt)
+		require.ErrorContains(t, err, "invalid empty content marker", marker)
+
+		var cpy []Calculator
+		err = UnmarshalWithTypeIDs([]byte(`[{"marker":`+marker+`}]`), &cpy, newByTypeIDer, opt)
+		require.ErrorContains(t, err, "invalid empty content marker", marker)
+	}
+}
+
+func TestMarshalRawMessageVerbatim(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	fragment, err := MarshalWithTypeIDs([]Calculator{CalculatorLinear{K: 1}}, typeIDHandler)
+	require.NoError(t, err)
+	raw := json.RawMessage(fragment)
+	type doc struct {
+		Fragment json.RawMessage
+		Pointer  *json.RawMessage
+		ByName   map[string]json.RawMessage
+		Nil      json.RawMessage
+	}
+	obj := doc{
+		Fragment: raw,
+		Pointer:  &raw,
+		ByName:   map[string]json.RawMessage{"a": json.RawMessage(" {\n\"x\": 1} ")},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"ByName":{"a":{"x":1}},"Fragment":`+string(fragment)+`,"Nil":null,"Pointer":`+string(fragment)+`}`, string(b))
+
+	var cpy doc
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+	var calculators []Calculator
+	require.NoError(t, UnmarshalWithTypeIDs(cpy.Fragment, &calculators, typeIDHandler))
+	require.Equal(t, []Calculator{CalculatorLinear{K: 1}}, calculators)
+
+	_, err = MarshalWithTypeIDs(doc{Fragment: json.RawMessage(`{`)}, typeIDHandler)
+	require.Error(t, err)
+}
+
+func TestMarshalSkipUnknown(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	typeIDOfer := TypeIDOferFunc(func(sample any) (TypeID, error) {
+		if _, ok := sample.(CalculatorLinear); ok {
+			return typeIDHandler.TypeIDOf(sample)
+		}
+		return "", ErrTypeIDNotRegistered{TypeID: typeToID(reflect.TypeOf(sample))}
+	})
+	type dump struct {
+		Known   Calculator `json:",skipunknown"`
+		Unknown Calculator `json:",skipunknown"`
+		Nested  struct {
+			Calculator Calculator
+		} `json:",skipunknown"`
+		Strict Calculator
+	}
+
+	obj := dump{
+		Known:   CalculatorLinear{K: 1},
+		Unknown: &CalculatorConst{C: 2},
+	}
+	b, err := MarshalWithTypeIDs(obj, typeIDOfer)
+	require.NoError(t, err)
+	require.Equal(t, `{"Known":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"Nested":{"Calculator":null},"Strict":null}`, string(b))
+
+	obj.Strict = &CalculatorConst{C: 3}
+	_, err = MarshalWithTypeIDs(obj, typeIDOfer)
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+
+	obj.Strict = nil
+	obj.Nested.Calculator = &CalculatorConst{C: 4}
+	_, err = MarshalWithTypeIDs(obj, typeIDOfer)
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+
+	t.Run("minimal_wrapping", func(t *testing.T) {
+		isolateTypeRegistry(t)
+		RegisterType(soleImpl{})
+		type doc struct {
+			Sole soleIface `json:",skipunknown"`
+		}
+		b, err := MarshalWithTypeIDs(doc{Sole: &soleImpl{A: 1}}, TypeRegistry(), WithMinimalWrapping(true))
+		require.NoError(t, err)
+		require.Equal(t, `{"Sole":{"A":1}}`, string(b))
+	})
+}
+
+type stdlibCompatInner struct {
+	Z float64
+	A string `json:"a,omitempty"`
+}
+
+type stdlibCompatSample struct {
+	Zeta    int
+	Alpha   string
+	HTML    string
+	Line    string
+	Float   float64
+	Small   float32
+	Big     float64
+	ID      int64 `json:",string"`
+	Flag    bool  `json:"flag,omitempty"`
+	Bytes   []byte
+	Time    time.Time
+	Number  json.Number
+	Raw     json.RawMessage
+	Map     map[string]int
+	Nil     []int
+	Empty   []int
+	Inner   stdlibCompatInner
+	Pointer *stdlibCompatInner
+	Skipped int `json:"-"`
+}
+
+// stdlibCompatKey is a map key type implementing encoding.TextMarshaler.
+type stdlibCompatKey struct {
+	Major, Minor int
+}
+
+func (k stdlibCompatKey) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "v%d.%d", k.Major, k.Minor), nil
+}
+
+func (k *stdlibCompatKey) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "v%d.%d", &k.Major, &k.Minor)
+	return err
+}
+
+type StdlibCompatBase struct {
+	ID int
+}
+
+type stdlibCompatMaps struct {
+	Ints  map[int]string
+	Uints map[uint8]bool
+	Texts map[stdlibCompatKey]int
+	Calc  Calculator
+}
+
+func TestMarshalStdlibCompatibility(t *testing.T) {
+	samples := []any{
+		stdlibCompatSample{
+			Zeta:    -1,
+			Alpha:   "a",
+			HTML:    "<a href=\"x\">&</a>",
+			Line:    "  \t\x01é",
+			Float:   0.1,
+			Small:   3.14,
+			Big:     1e21,
+			ID:      1 << 60,
+			Bytes:   []byte("bytes"),
+			Time:    time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC),
+			Number:  "1.50",
+			Raw:     json.RawMessage(`{ "b": "<tag>", "a": [1, 2] }`),
+			Map:     map[string]int{"z": 1, "a": 2, "<": 3},
+			Empty:   []int{},
+			Inner:   stdlibCompatInner{Z: -0.000001},
+			Pointer: &stdlibCompatInner{A: "x"},
+		},
+		stdlibCompatSample{},
+		map[string]stdlibCompatInner{"b": {Z: 1}, "a": {A: "&"}},
+		[]stdlibCompatInner{{Z: 1e-7}, {}},
+		struct{ M map[int]string }{M: map[int]string{10: "b", 2: "a", -1: "c"}},
+		map[stdlibCompatKey]int{{Major: 1, Minor: 10}: 1, {Major: 1, Minor: 2}: 2},
+		stdlibCompatMaps{
+			Ints:  map[int]string{1: "a"},
+			Uints: map[uint8]bool{255: true},
+			Texts: map[stdlibCompatKey]int{{Major: 2}: 3},
+		},
+	}
+
+	for _, sample := range samples {
+		t.Run(fmt.Sprintf("%T", sample), func(t *testing.T) {
+			expected, err := json.Marshal(sample)
+			require.NoError(t, err)
+
+			b, err := MarshalWithTypeIDs(sample, typeIDHandlerT{}, WithStdlibKeyOrder(true))
+			require.NoError(t, err)
+			require.Equal(t, string(expected), string(b))
+		})
+	}
+
+	t.Run("map_keys_round_trip", func(t *testing.T) {
+		obj := stdlibCompatMaps{
+			Ints:  map[int]string{-7: "a", 8: "b"},
+			Uints: map[uint8]bool{255: true},
+			Texts: map[stdlibCompatKey]int{{Major: 2, Minor: 1}: 3},
+			Calc:  CalculatorLinear{K: 1},
+		}
+		b, err := MarshalWithTypeIDs(obj, typeIDHandlerT{}, WithStdlibKeyOrder(true))
+		require.NoError(t, err)
+		require.Equal(t, `{"Ints":{"-7":"a","8":"b"},"Uints":{"255":true},"Texts":{"v2.1":3},"Calc":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}}`, string(b))
+
+		var cpy stdlibCompatMaps
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandlerT{}))
+		require.Equal(t, obj, cpy)
+
+		err = UnmarshalWithTypeIDs([]byte(`{"Uints":{"256":true}}`), &cpy, typeIDHandlerT{})
+		require.Error(t, err)
+	})
+
+	t.Run("embedded_structures", func(t *testing.T) {
+		// unlike "encoding/json", the fields are not promoted (see WithStdlibKeyOrder)
+		type embedding struct {
+			StdlibCompatBase
+			Name string
+		}
+		obj := embedding{StdlibCompatBase: StdlibCompatBase{ID: 1}, Name: "x"}
+
+		expected, err := json.Marshal(obj)
+		require.NoError(t, err)
+		require.Equal(t, `{"ID":1,"Name":"x"}`, string(expected))
+
+		b, err := MarshalWithTypeIDs(obj, typeIDHandlerT{}, WithStdlibKeyOrder(true))
+		require.NoError(t, err)
+		require.Equal(t, `{"StdlibCompatBase":{"ID":1},"Name":"x"}`, string(b))
+
+		var cpy embedding
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandlerT{}))
+		require.Equal(t, obj, cpy)
+
+		// an embedded structure of an unexported type is skipped as any unexported field
+		type unexportedEmbedding struct {
+			stdlibCompatInner
+			Name string
+		}
+		b, err = MarshalWithTypeIDs(unexportedEmbedding{stdlibCompatInner: stdlibCompatInner{Z: 1}, Name: "x"}, typeIDHandlerT{}, WithStdlibKeyOrder(true))
+		require.NoError(t, err)
+		require.Equal(t, `{"Name":"x"}`, string(b))
+	})
+
+	t.Run("sorted_by_default", func(t *testing.T) {
+		b, err := MarshalWithTypeIDs(stdlibCompatInner{Z: 1, A: "x"}, typeIDHandlerT{})
+		require.NoError(t, err)
+		require.Equal(t, `{"Z":1,"a":"x"}`, string(b))
+
+		b, err = MarshalWithTypeIDs(struct {
+			B int
+			A int
+		}{}, typeIDHandlerT{})
+		require.NoError(t, err)
+		require.Equal(t, `{"A":0,"B":0}`, string(b))
+	})
+}
+
+func TestMarshalFieldOrder(t *testing.T) {
+	type sample struct {
+		Zeta    int
+		Beta    int
+		Name    string `json:"name" polyjson:"order=1"`
+		Alpha   int
+		Kind    string `polyjson:"order=0"`
+		Version int    `polyjson:"order=1"`
+	}
+
+	b, err := MarshalWithTypeIDs(sample{}, typeIDHandlerT{})
+	require.NoError(t, err)
+	require.Equal(t, `{"Kind":"","name":"","Version":0,"Alpha":0,"Beta":0,"Zeta":0}`, string(b))
+
+	b, err = MarshalWithTypeIDs(sample{}, typeIDHandlerT{}, WithStdlibKeyOrder(true))
+	require.NoError(t, err)
+	require.Equal(t, `{"Kind":"","name":"","Version":0,"Zeta":0,"Beta":0,"Alpha":0}`, string(b))
+
+	var cpy sample
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandlerT{}))
+
+	// the same inside containers
+	expected := `{"Kind":"","name":"","Version":0,"Alpha":0,"Beta":0,"Zeta":0}`
+	expectedStdlib := `{"Kind":"","name":"","Version":0,"Zeta":0,"Beta":0,"Alpha":0}`
+	for _, opts := range [][]Option{nil, {WithStdlibKeyOrder(true)}} {
+		item := expected
+		if len(opts) != 0 {
+			item = expectedStdlib
+		}
+
+		b, err = MarshalWithTypeIDs([]sample{{}}, typeIDHandlerT{}, opts...)
+		require.NoError(t, err)
+		require.Equal(t, `[`+item+`]`, string(b))
+
+		b, err = MarshalWithTypeIDs([1]*sample{{}}, typeIDHandlerT{}, opts...)
+		require.NoError(t, err)
+		require.Equal(t, `[`+item+`]`, string(b))
+
+		b, err = MarshalWithTypeIDs(map[string]sample{"a": {}}, typeIDHandlerT{}, opts...)
+		require.NoError(t, err)
+		require.Equal(t, `{"a":`+item+`}`, string(b))
+	}
+
+	_, err = MarshalWithTypeIDs(struct {
+		A int `polyjson:"order=first"`
+	}{}, typeIDHandlerT{})
+	require.ErrorContains(t, err, "invalid order")
+}
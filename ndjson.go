@@ -0,0 +1,158 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type optionMalformedLineHandler func(line int, err error) error
+
+func (opt optionMalformedLineHandler) apply(cfg *config) {
+	cfg.MalformedLineHandler = opt
+}
+
+// WithMalformedLineHandler makes DecodeNDJSON to call the handler for every line,
+// which could not be decoded (the line number starts from 1, and the error
+// is ErrMalformedLine). If the handler returns nil, then the line is skipped,
+// otherwise the decoding is stopped with the returned error.
+//
+// By default the decoding is stopped on the first malformed line.
+func WithMalformedLineHandler(handler func(line int, err error) error) Option {
+	return optionMalformedLineHandler(handler)
+}
+
+// ErrMalformedLine means a line of a newline-delimited JSON stream
+// could not be decoded (see DecodeNDJSON).
+type ErrMalformedLine struct {
+	Line int
+	Err  error
+}
+
+// Error implements interface "error".
+func (e ErrMalformedLine) Error() string {
+	return fmt.Sprintf("unable to decode line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the reason why the line could not be decoded.
+func (e ErrMalformedLine) Unwrap() error {
+	return e.Err
+}
+
+// DecodeNDJSON reads a stream of newline-delimited JSON values (NDJSON),
+// where every line is a single type-tagged value (`{TypeID:content}`, see
+// UnmarshalValue), and calls yield for every reconstructed value. Empty
+// lines are skipped. If yield returns an error, then the decoding is stopped
+// and the error is returned.
+//
+// See also WithMalformedLineHandler and EncodeNDJSON.
+func DecodeNDJSON(r io.Reader, newByTypeIDer NewByTypeIDer, yield func(any) error, opts ...Option) error {
+	malformedLineHandler := Options(opts).config().MalformedLineHandler
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("unable to read line %d: %w", lineNum, err)
+		}
+		eof := err != nil
+
+		if line = bytes.TrimSpace(line); len(line) != 0 {
+			value, decodeErr := decodeNDJSONLine(line, newByTypeIDer, opts...)
+			switch {
+			case decodeErr == nil:
+				if err := yield(value); err != nil {
+					return err
+				}
+			case malformedLineHandler == nil:
+				return ErrMalformedLine{Line: lineNum, Err: decodeErr}
+			default:
+				if err := malformedLineHandler(lineNum, ErrMalformedLine{Line: lineNum, Err: decodeErr}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if eof {
+			return nil
+		}
+	}
+}
+
+func decodeNDJSONLine(line []byte, newByTypeIDer NewByTypeIDer, opts ...Option) (any, error) {
+	doc, err := ParseWithTypeIDs(line)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := doc.Into(&value, newByTypeIDer, opts...); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// EncodeNDJSON writes the values as a stream of newline-delimited JSON values
+// (NDJSON): every value is written as a compact single type-tagged value
+// (`{TypeID:content}`) per line, so every line could be decoded independently
+// (see DecodeNDJSON).
+//
+// See also NDJSONEncoder to encode with options.
+func EncodeNDJSON(w io.Writer, typeIDOfer TypeIDOfer, values ...any) error {
+	return NewNDJSONEncoder(w, typeIDOfer).Encode(values...)
+}
+
+// NDJSONEncoder writes values as a stream of newline-delimited JSON values
+// (see EncodeNDJSON) using the given options.
+type NDJSONEncoder struct {
+	writer    io.Writer
+	marshaler *marshaler
+
+	// count is the amount of values written so far.
+	count int
+}
+
+// NewNDJSONEncoder returns a new NDJSONEncoder writing to w.
+//
+// The options are the same as for MarshalWithTypeIDs, and they should
+// match the options given to DecodeNDJSON (for example WithFormat
+// or WithFormatMarker, which adds the marker to every line).
+func NewNDJSONEncoder(w io.Writer, typeIDOfer TypeIDOfer, opts ...Option) *NDJSONEncoder {
+	return &NDJSONEncoder{
+		writer: w,
+		marshaler: &marshaler{
+			typeIDOfer: typeIDOfer,
+			config:     Options(opts).config(),
+		},
+	}
+}
+
+// Encode writes the values, one line per value.
+func (e *NDJSONEncoder) Encode(values ...any) error {
+	for _, value := range values {
+		idx := e.count
+		b, err := e.marshaler.marshalAny(value, nil)
+		if err == nil {
+			b, err = e.marshaler.addFormatMarker(b)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to encode value #%d: %w", idx, err)
+		}
+		if _, err := e.writer.Write(append(b, '\n')); err != nil {
+			return fmt.Errorf("unable to write value #%d: %w", idx, err)
+		}
+		e.count++
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeNDJSON(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	const stream = `{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}
+
+{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}}
+{"github.com/xaionaro-go/polyjson.CalculatorLinear":
+{"unknown":{}}
+{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":3}}`
+
+	var values []any
+	collect := func(value any) error {
+		values = append(values, value)
+		return nil
+	}
+
+	var errMalformed ErrMalformedLine
+	err := DecodeNDJSON(strings.NewReader(stream), typeIDHandler, collect)
+	require.ErrorAs(t, err, &errMalformed)
+	require.Equal(t, 4, errMalformed.Line)
+	require.Equal(t, []any{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}}, values)
+
+	values = nil
+	var malformedLines []int
+	err = DecodeNDJSON(strings.NewReader(stream), typeIDHandler, collect, WithMalformedLineHandler(func(line int, err error) error {
+		require.ErrorAs(t, err, &ErrMalformedLine{})
+		malformedLines = append(malformedLines, line)
+		return nil
+	}))
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 5}, malformedLines)
+	require.Equal(t, []any{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}, CalculatorLinear{K: 3}}, values)
+
+	errStop := errors.New("stop")
+	err = DecodeNDJSON(strings.NewReader(stream), typeIDHandler, func(any) error { return errStop })
+	require.Equal(t, errStop, err)
+}
+
+func TestEncodeNDJSON(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	values := []any{
+		CalculatorLinear{K: 1},
+		&CalculatorConst{C: 2},
+		Struct3{Int2: 3},
+	}
+
+	var buf strings.Builder
+	require.NoError(t, EncodeNDJSON(&buf, typeIDHandler, CalculatorLinear{K: 1}, &CalculatorConst{C: 2}, Struct3{Int2: 3}))
+	require.Equal(t, `{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}
+{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}}
+{"github.com/xaionaro-go/polyjson.Struct3":{"Int2":3}}
+`, buf.String())
+
+	var cpy []any
+	require.NoError(t, DecodeNDJSON(strings.NewReader(buf.String()), typeIDHandler, func(value any) error {
+		cpy = append(cpy, value)
+		return nil
+	}))
+	require.Equal(t, values, cpy)
+
+	// the options are applied to every line
+	for _, opt := range []Option{WithFormat(FormatTupleArray), WithFormatMarker("_v")} {
+		buf.Reset()
+		encoder := NewNDJSONEncoder(&buf, typeIDHandler, opt)
+		require.NoError(t, encoder.Encode(values[0]))
+		require.NoError(t, encoder.Encode(values[1:]...))
+
+		cpy = cpy[:0]
+		require.NoError(t, DecodeNDJSON(strings.NewReader(buf.String()), typeIDHandler, func(value any) error {
+			cpy = append(cpy, value)
+			return nil
+		}, opt))
+		require.Equal(t, values, cpy)
+	}
+	require.Equal(t, `{"_v":"`+FormatVersion+`","github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}`, strings.Split(buf.String(), "\n")[0])
+}
@@ -0,0 +1,426 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Option is an optional argument for MarshalWithTypeIDs and UnmarshalWithTypeIDs.
+type Option interface {
+	apply(*config)
+}
+
+// Options is a set of Option-s.
+type Options []Option
+
+func (s Options) config() config {
+	cfg := config{}
+	for _, opt := range s {
+		opt.apply(&cfg)
+	}
+	return cfg
+}
+
+type config struct {
+	Lenient                bool
+	ErrorValues            bool
+	DisallowDuplicateKeys  bool
+	ParentDiscriminators   []parentDiscriminator
+	HasMaxDepth            bool
+	MaxDepth               int
+	NumericCoercion        bool
+	Tracer                 Tracer
+	HasNullRepresentation  bool
+	NullRepresentation     json.RawMessage
+	UnknownFieldHandler    func(path, name string)
+	FieldFilter            func(path string, field reflect.StructField) bool
+	TypeIDNormalization    bool
+	Context                context.Context
+	MinimalWrapping        bool
+	StrictAssignment       bool
+	ForcedTypeIDs          map[string]TypeID
+	DisallowTrailingData   bool
+	PointerTypeIDs         bool
+	DecodeTimeout          time.Duration
+	MalformedLineHandler   func(line int, err error) error
+	PostConstruct          func(any) error
+	HasEmptyContentMarker  bool
+	EmptyContentMarker     json.RawMessage
+	CollectErrors          bool
+	StdlibKeyOrder         bool
+	Format                 Format
+	PlainScalars           bool
+	Allocator              func(reflect.Type) reflect.Value
+	FormatMarker           string
+	PolyTypeFallback       bool
+	EnvelopeVersionKey     string
+	EnvelopeDataKey        string
+	CaseInsensitiveTypeIDs bool
+}
+
+type parentDiscriminator struct {
+	FieldName string
+	Mapping   map[string]TypeID
+}
+
+type optionLenient bool
+
+func (opt optionLenient) apply(cfg *config) {
+	cfg.Lenient = bool(opt)
+}
+
+// WithLenient allows interface values without the TypeID wrapper
+// (for example, in legacy documents) if the concrete type
+// could be determined otherwise (see RegisterDefaultImpl).
+func WithLenient(lenient bool) Option {
+	return optionLenient(lenient)
+}
+
+type optionErrorValues bool
+
+func (opt optionErrorValues) apply(cfg *config) {
+	cfg.ErrorValues = bool(opt)
+}
+
+// WithErrorValues enables the built-in support of values of interface
+// type `error`: they are marshaled as {"error":"message string"}
+// (regardless of the concrete type), and unmarshaled back as errors.New("message string").
+func WithErrorValues(enable bool) Option {
+	return optionErrorValues(enable)
+}
+
+type optionDisallowDuplicateKeys bool
+
+func (opt optionDisallowDuplicateKeys) apply(cfg *config) {
+	cfg.DisallowDuplicateKeys = bool(opt)
+}
+
+// WithDisallowDuplicateKeys makes UnmarshalWithTypeIDs to return ErrDuplicateKey
+// if any object in the document has duplicate keys (by default the last one wins).
+func WithDisallowDuplicateKeys(disallow bool) Option {
+	return optionDisallowDuplicateKeys(disallow)
+}
+
+type optionParentDiscriminator parentDiscriminator
+
+func (opt optionParentDiscriminator) apply(cfg *config) {
+	cfg.ParentDiscriminators = append(cfg.ParentDiscriminators, parentDiscriminator(opt))
+}
+
+// WithParentDiscriminator makes UnmarshalWithTypeIDs to determine the concrete type
+// of interface fields of a structure by the value of the sibling field fieldName
+// (a discriminator of an externally defined tagged union). Such interface
+// values are expected without the TypeID wrapper.
+//
+// For example, with mapping {"linear": "CalculatorLinear"} the document
+//
+//	{"kind": "linear", "calculator": {"K": 2}}
+//
+// is decoded as if it was {"kind": "linear", "calculator": {"CalculatorLinear": {"K": 2}}}.
+func WithParentDiscriminator(fieldName string, mapping map[string]TypeID) Option {
+	return optionParentDiscriminator{
+		FieldName: fieldName,
+		Mapping:   mapping,
+	}
+}
+
+type optionMaxDepth int
+
+func (opt optionMaxDepth) apply(cfg *config) {
+	cfg.HasMaxDepth = true
+	cfg.MaxDepth = int(opt)
+}
+
+type optionNumericCoercion bool
+
+func (opt optionNumericCoercion) apply(cfg *config) {
+	cfg.NumericCoercion = bool(opt)
+}
+
+// WithNumericCoercion makes UnmarshalWithTypeIDs to accept a type-tagged number
+// (for example {"int":1}) for a numeric destination of a different type
+// (for example int64), if the number fits into the destination type.
+// A number, which does not fit (out of range, or not an integer for
+// an integer destination), causes an error.
+func WithNumericCoercion(enable bool) Option {
+	return optionNumericCoercion(enable)
+}
+
+type optionNullRepresentation json.RawMessage
+
+func (opt optionNullRepresentation) apply(cfg *config) {
+	cfg.HasNullRepresentation = true
+	cfg.NullRepresentation = json.RawMessage(opt)
+}
+
+// WithNullRepresentation makes MarshalWithTypeIDs to put the given JSON
+// instead of "null" for nil pointers, interfaces and maps.
+//
+// If repr is empty, then such structure fields and map entries are omitted
+// (while nil items of arrays and a nil top-level value are still put as "null").
+func WithNullRepresentation(repr json.RawMessage) Option {
+	return optionNullRepresentation(repr)
+}
+
+type optionUnknownFieldHandler func(path, name string)
+
+func (opt optionUnknownFieldHandler) apply(cfg *config) {
+	cfg.UnknownFieldHandler = opt
+}
+
+// WithUnknownFieldHandler makes UnmarshalWithTypeIDs to call the handler
+// for every JSON field, which has no corresponding structure field
+// (such fields are still ignored). It allows to observe schema drifts
+// without failing the decoding.
+//
+// The path is the path of the structure (for example "$.Plugins[0]"),
+// and the name is the name of the unknown field.
+func WithUnknownFieldHandler(handler func(path, name string)) Option {
+	return optionUnknownFieldHandler(handler)
+}
+
+type optionFieldFilter func(path string, field reflect.StructField) bool
+
+func (opt optionFieldFilter) apply(cfg *config) {
+	cfg.FieldFilter = opt
+}
+
+// WithFieldFilter makes MarshalWithTypeIDs to omit every structure field,
+// for which the filter returns false (for example, to produce a redacted
+// version of a document). The path is the path of the field
+// (for example "$.Users[0].Password").
+//
+// The filter is called only for fields, which are not skipped otherwise
+// (by tag `json:"-"` or options "omitempty" and "omitemptydeep").
+func WithFieldFilter(filter func(path string, field reflect.StructField) bool) Option {
+	return optionFieldFilter(filter)
+}
+
+type optionTypeIDNormalization bool
+
+func (opt optionTypeIDNormalization) apply(cfg *config) {
+	cfg.TypeIDNormalization = bool(opt)
+}
+
+// WithTypeIDNormalization makes UnmarshalWithTypeIDs to tolerate both fully
+// qualified (for example "github.com/my/app/pkg.Foo") and unqualified
+// (for example "Foo") forms of TypeIDs. If the TypeID is unknown, then
+// the unqualified form is tried, and then all the known TypeIDs
+// (if the NewByTypeIDer implements TypeIDLister) with the same unqualified
+// form. If there are multiple such TypeIDs, then ErrAmbiguousTypeID is returned.
+func WithTypeIDNormalization(enable bool) Option {
+	return optionTypeIDNormalization(enable)
+}
+
+// optionContext makes the decoding to be aborted when the context is
+// cancelled (see UnmarshalWithTypeIDsContext).
+type optionContext struct {
+	Context context.Context
+}
+
+func (opt optionContext) apply(cfg *config) {
+	cfg.Context = opt.Context
+}
+
+type optionMinimalWrapping bool
+
+func (opt optionMinimalWrapping) apply(cfg *config) {
+	cfg.MinimalWrapping = bool(opt)
+}
+
+// WithMinimalWrapping makes MarshalWithTypeIDs to put the value of an interface
+// without the TypeID wrapper if exactly one registered type (see RegisterType)
+// implements the interface, and UnmarshalWithTypeIDs to decode such values
+// (wrapped values are still accepted). It never applies to the empty
+// interface ("any"), since any value could be stored in it.
+//
+// The implementation is determined by the global type registry, so both sides
+// should have the same set of registered types and the same option. The option
+// has no effect if the TypeIDOfer/NewByTypeIDer is not the type registry
+// (see TypeRegistry).
+func WithMinimalWrapping(enable bool) Option {
+	return optionMinimalWrapping(enable)
+}
+
+type optionStrictAssignment bool
+
+func (opt optionStrictAssignment) apply(cfg *config) {
+	cfg.StrictAssignment = bool(opt)
+}
+
+// WithStrictAssignment makes UnmarshalWithTypeIDs to require the NewByTypeIDer
+// to return a pointer to a value assignable to the interface, instead of
+// accommodating handlers which return values, or pointers to types implementing
+// the interface only by pointer. It allows to catch misbehaving handlers.
+func WithStrictAssignment(strict bool) Option {
+	return optionStrictAssignment(strict)
+}
+
+type optionForcedTypeID struct {
+	Path   string
+	TypeID TypeID
+}
+
+func (opt optionForcedTypeID) apply(cfg *config) {
+	if cfg.ForcedTypeIDs == nil {
+		cfg.ForcedTypeIDs = map[string]TypeID{}
+	}
+	cfg.ForcedTypeIDs[opt.Path] = opt.TypeID
+}
+
+// WithForcedTypeID makes MarshalWithTypeIDs to wrap the interface value
+// at the given path (for example "$.Plugins[0]") with the given TypeID
+// instead of the TypeID of its concrete type (for example, to produce
+// documents for older consumers). The content is still marshaled
+// from the actual value, so the caller is responsible for the forced type
+// to be compatible with it. The value is wrapped even if it would not be
+// otherwise (see WithMinimalWrapping).
+//
+// The option may be used multiple times for different paths.
+func WithForcedTypeID(path string, id TypeID) Option {
+	return optionForcedTypeID{Path: path, TypeID: id}
+}
+
+type optionDisallowTrailingData bool
+
+func (opt optionDisallowTrailingData) apply(cfg *config) {
+	cfg.DisallowTrailingData = bool(opt)
+}
+
+// WithDisallowTrailingData makes UnmarshalWithTypeIDs (and ParsedDocument.Into)
+// to return ErrTrailingData if there is anything but whitespace after
+// the top-level value (by default it is ignored). It allows to detect
+// concatenated or corrupted documents.
+func WithDisallowTrailingData(disallow bool) Option {
+	return optionDisallowTrailingData(disallow)
+}
+
+type optionDecodeTimeout time.Duration
+
+func (opt optionDecodeTimeout) apply(cfg *config) {
+	cfg.DecodeTimeout = time.Duration(opt)
+}
+
+// WithDecodeTimeout makes UnmarshalWithTypeIDs to return ErrDecodeTimeout
+// if the decoding takes longer than the given duration. It is a backstop
+// against adversarial documents (in addition to limiting the size of the input).
+//
+// The time is checked per each decoded value, so a slow NewByTypeIDer
+// or json.Unmarshaler is not interrupted.
+func WithDecodeTimeout(timeout time.Duration) Option {
+	return optionDecodeTimeout(timeout)
+}
+
+type optionPostConstruct func(any) error
+
+func (opt optionPostConstruct) apply(cfg *config) {
+	cfg.PostConstruct = opt
+}
+
+// WithPostConstruct makes UnmarshalWithTypeIDs to call the hook for every
+// value constructed for an interface (see NewByTypeIDer) after its content
+// is decoded, but before it is stored into the interface. The value is given
+// as a pointer, so the hook could wire dependencies (for example a logger)
+// into it. An error returned by the hook aborts the decoding.
+func WithPostConstruct(hook func(any) error) Option {
+	return optionPostConstruct(hook)
+}
+
+type optionEmptyContentMarker json.RawMessage
+
+func (opt optionEmptyContentMarker) apply(cfg *config) {
+	cfg.HasEmptyContentMarker = true
+	cfg.EmptyContentMarker = json.RawMessage(opt)
+}
+
+// WithEmptyContentMarker makes MarshalWithTypeIDs to put the given (compact)
+// JSON instead of an empty object as the content of a TypeID wrapper (for
+// example `{"Marker":[]}` instead of `{"Marker":{}}` for a marker type without
+// exported fields), and UnmarshalWithTypeIDs to decode such content of
+// a structure or a map as an empty object. The option should be used on both sides.
+//
+// The marker should be a JSON array (otherwise it could be confused
+// with the content of scalars, nulls or non-empty objects), and
+// the marshaling/unmarshaling fails if it is not.
+func WithEmptyContentMarker(marker json.RawMessage) Option {
+	return optionEmptyContentMarker(marker)
+}
+
+// checkEmptyContentMarker returns an error if the marker is not
+// a JSON array (see WithEmptyContentMarker).
+func checkEmptyContentMarker(marker json.RawMessage) error {
+	if len(marker) == 0 || marker[0] != '[' || !json.Valid(marker) {
+		return fmt.Errorf("invalid empty content marker '%s': expected a JSON array", marker)
+	}
+	return nil
+}
+
+type optionCollectErrors bool
+
+func (opt optionCollectErrors) apply(cfg *config) {
+	cfg.CollectErrors = bool(opt)
+}
+
+// WithCollectErrors makes UnmarshalWithTypeIDs to continue the decoding
+// after a structure field, an item or a map entry failed to be decoded,
+// and to return all such errors joined (see errors.Join), each prefixed
+// with the path of the value (for example "$.Plugins[0].Calculator: ...").
+// It allows to report all the problems of a document at once.
+//
+// The values, which failed to be decoded, are left partially decoded.
+func WithCollectErrors(enable bool) Option {
+	return optionCollectErrors(enable)
+}
+
+type optionStdlibKeyOrder bool
+
+func (opt optionStdlibKeyOrder) apply(cfg *config) {
+	cfg.StdlibKeyOrder = bool(opt)
+}
+
+// WithStdlibKeyOrder makes MarshalWithTypeIDs to put the fields of structures
+// in the order of declaration (instead of the sorted order), the same as
+// "encoding/json" does. Keys of maps are always sorted and stringified
+// the same way as by json.Marshal (including integer and
+// encoding.TextMarshaler keys).
+//
+// The output is still not identical to the output of json.Marshal for
+// embedded structures: their fields are not promoted, an embedded structure
+// is put as a field named after its type (for example {"Base":{"ID":1}}
+// instead of {"ID":1}), and an embedded structure of an unexported type
+// is skipped (as any unexported field).
+func WithStdlibKeyOrder(enable bool) Option {
+	return optionStdlibKeyOrder(enable)
+}
+
+type optionPolyTypeFallback bool
+
+func (opt optionPolyTypeFallback) apply(cfg *config) {
+	cfg.PolyTypeFallback = bool(opt)
+}
+
+// WithPolyTypeFallback makes MarshalWithTypeIDs to use the result of method
+// PolyType (see PolyTyper) as the TypeID of a value, which TypeID
+// is not provided by the TypeIDOfer (for example, the type is not registered),
+// instead of failing.
+//
+// It is intended for rapid prototyping only: such TypeIDs are still
+// unknown to NewByTypeID unless the type is registered.
+func WithPolyTypeFallback(enable bool) Option {
+	return optionPolyTypeFallback(enable)
+}
@@ -0,0 +1,108 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// ParsedDocument is a parsed JSON document, which could be unmarshaled
+// into multiple destinations without re-parsing (see ParseWithTypeIDs).
+type ParsedDocument struct {
+	// raw is the whole document (see WithDisallowTrailingData).
+	raw  string
+	root gjson.Result
+}
+
+// newParsedDocument returns a ParsedDocument of the (not validated) document.
+func newParsedDocument(b []byte) *ParsedDocument {
+	raw := string(b)
+	return &ParsedDocument{
+		raw:  raw,
+		root: gjson.Parse(raw),
+	}
+}
+
+// ParseWithTypeIDs parses the JSON document (serialized by
+// MarshalWithTypeIDs) to be unmarshaled later, possibly multiple times
+// (for example to extract different views of the same document).
+func ParseWithTypeIDs(b []byte) (*ParsedDocument, error) {
+	if !gjson.ValidBytes(b) {
+		return nil, fmt.Errorf("invalid JSON")
+	}
+	return newParsedDocument(b), nil
+}
+
+// Into unmarshals the document into dst, see UnmarshalWithTypeIDs.
+//
+// It is safe to call Into multiple times, including concurrently.
+func (doc *ParsedDocument) Into(dst any, newByTypeIDer NewByTypeIDer, opts ...Option) error {
+	u := &unmarshaler{
+		newByTypeIDer: newByTypeIDer,
+		config:        Options(opts).config(),
+	}
+	if u.DecodeTimeout > 0 {
+		u.deadline = time.Now().Add(u.DecodeTimeout)
+	}
+	if u.DisallowTrailingData {
+		if err := checkTrailingData(doc.raw); err != nil {
+			return err
+		}
+	}
+	if u.DisallowDuplicateKeys {
+		if err := checkDuplicateKeys(doc.root, nil); err != nil {
+			return err
+		}
+	}
+	root, err := u.stripFormatMarker(doc.root)
+	if err != nil {
+		return err
+	}
+	err = u.unmarshal(root, reflect.ValueOf(dst), nil)
+	if len(u.collectedErrors) != 0 {
+		return errors.Join(append(u.collectedErrors, err)...)
+	}
+	return err
+}
+
+// checkDuplicateKeys returns ErrDuplicateKey if any object within
+// the value has duplicate keys.
+func checkDuplicateKeys(value gjson.Result, path valuePath) error {
+	var err error
+	switch {
+	case value.IsObject():
+		keys := map[string]struct{}{}
+		value.ForEach(func(key, item gjson.Result) bool {
+			if _, ok := keys[key.Str]; ok {
+				err = ErrDuplicateKey{Key: key.Str, Path: path.String()}
+				return false
+			}
+			keys[key.Str] = struct{}{}
+			err = checkDuplicateKeys(item, path.Member(key.Str))
+			return err == nil
+		})
+	case value.IsArray():
+		idx := 0
+		value.ForEach(func(_, item gjson.Result) bool {
+			err = checkDuplicateKeys(item, path.Index(idx))
+			idx++
+			return err == nil
+		})
+	}
+	return err
+}
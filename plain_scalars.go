@@ -0,0 +1,68 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"reflect"
+
+	"github.com/tidwall/gjson"
+)
+
+type optionPlainScalars bool
+
+func (opt optionPlainScalars) apply(cfg *config) {
+	cfg.PlainScalars = bool(opt)
+}
+
+// WithPlainScalars makes MarshalWithTypeIDs to put values of the predeclared
+// scalar types (bool, string, and the numeric types) stored in interfaces
+// without the TypeID wrapper, and UnmarshalWithTypeIDs to decode a JSON
+// scalar stored in an interface into its natural Go type (bool, string or
+// float64, the same as "encoding/json" does), for example:
+//
+//	[]any{1, "two", nil, Foo{}}
+//
+// is marshaled as:
+//
+//	[1,"two",null,{"Foo":{}}]
+//
+// Values of named scalar types (for example `type Color int`) are still
+// wrapped, since their types could not be restored otherwise. The option
+// should be used on both sides.
+func WithPlainScalars(enable bool) Option {
+	return optionPlainScalars(enable)
+}
+
+// isPlainScalarType returns true if the type is a predeclared
+// scalar type (see WithPlainScalars).
+func isPlainScalarType(t reflect.Type) bool {
+	if t.PkgPath() != "" || t.Name() == "" {
+		return false
+	}
+	return t.Kind() == reflect.Bool || t.Kind() == reflect.String || isNumeric(t)
+}
+
+// plainScalar returns the value of the JSON scalar in its natural
+// Go type if it could be stored in an interface of type ifaceType
+// (see WithPlainScalars).
+func (u *unmarshaler) plainScalar(value gjson.Result, ifaceType reflect.Type) (reflect.Value, bool) {
+	switch value.Type {
+	case gjson.String, gjson.Number, gjson.True, gjson.False:
+	default:
+		return reflect.Value{}, false
+	}
+	v := reflect.ValueOf(value.Value())
+	if !v.Type().Implements(ifaceType) {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
@@ -0,0 +1,63 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type plainScalarsEnum int
+
+func TestPlainScalars(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(CalculatorLinear{})
+	RegisterType(plainScalarsEnum(0))
+
+	obj := []any{1, "two", nil, CalculatorLinear{K: 3}, 4.5, true, plainScalarsEnum(6)}
+
+	_, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.Error(t, err, "the predeclared types are not registered")
+
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry(), WithPlainScalars(true))
+	require.NoError(t, err)
+	require.Equal(t, `[1,"two",null,{"CalculatorLinear":{"K":3}},4.5,true,{"plainScalarsEnum":6}]`, string(b))
+
+	var cpy []any
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, TypeRegistry(), WithPlainScalars(true)))
+	require.Equal(t, []any{float64(1), "two", nil, CalculatorLinear{K: 3}, 4.5, true, plainScalarsEnum(6)}, cpy)
+
+	t.Run("map", func(t *testing.T) {
+		obj := map[string]any{"n": 1, "s": "x", "c": CalculatorLinear{K: 1}}
+		b, err := MarshalWithTypeIDs(obj, TypeRegistry(), WithPlainScalars(true))
+		require.NoError(t, err)
+		require.Equal(t, `{"c":{"CalculatorLinear":{"K":1}},"n":1,"s":"x"}`, string(b))
+
+		var cpy map[string]any
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, TypeRegistry(), WithPlainScalars(true)))
+		require.Equal(t, map[string]any{"n": float64(1), "s": "x", "c": CalculatorLinear{K: 1}}, cpy)
+	})
+
+	t.Run("non_empty_interface", func(t *testing.T) {
+		// a float64 does not implement Calculator
+		var calculators []Calculator
+		err := UnmarshalWithTypeIDs([]byte(`[1]`), &calculators, TypeRegistry(), WithPlainScalars(true))
+		require.ErrorAs(t, err, &ErrNotTypeTagged{})
+	})
+
+	t.Run("without_option", func(t *testing.T) {
+		var cpy []any
+		err := UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+		require.ErrorAs(t, err, &ErrNotTypeTagged{})
+	})
+}
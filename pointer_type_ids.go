@@ -0,0 +1,72 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"reflect"
+	"strings"
+)
+
+type optionPointerTypeIDs bool
+
+func (opt optionPointerTypeIDs) apply(cfg *config) {
+	cfg.PointerTypeIDs = bool(opt)
+}
+
+// WithPointerTypeIDs makes MarshalWithTypeIDs to prefix the TypeID of a pointer
+// stored in an interface with "*" (per each level of indirection), and
+// UnmarshalWithTypeIDs to restore such pointers. Without the option a value
+// of type "any" holding *T is decoded as T if the TypeIDOfer returns the same
+// TypeID for T and *T (as the type registry does, see RegisterType).
+//
+// It is intended for TypeIDOfers, which do not distinguish pointers
+// (for others the prefix would be duplicated), and the option
+// should be used on both sides.
+func WithPointerTypeIDs(enable bool) Option {
+	return optionPointerTypeIDs(enable)
+}
+
+// pointerTypeIDPrefix returns "*" per each level of indirection of the type.
+func pointerTypeIDPrefix(t reflect.Type) string {
+	var prefix string
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		prefix += "*"
+	}
+	return prefix
+}
+
+// newByTypeID returns a pointer to a new value of the type defined by
+// the TypeID: if the TypeID has the pointer prefix (see WithPointerTypeIDs),
+// then the value is a pointer to the value defined by the rest of the TypeID.
+func (u *unmarshaler) newByTypeID(typeID TypeID) (any, error) {
+	if !u.PointerTypeIDs || !strings.HasPrefix(string(typeID), "*") {
+		return u.newByNormalizedTypeID(typeID)
+	}
+
+	elemTypeID := strings.TrimLeft(string(typeID), "*")
+	typedValuePtr, err := u.newByNormalizedTypeID(TypeID(elemTypeID))
+	if err != nil || typedValuePtr == nil {
+		return typedValuePtr, err
+	}
+
+	v := reflect.ValueOf(typedValuePtr)
+	for range len(typeID) - len(elemTypeID) {
+		ptr, err := u.new(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+	return v.Interface(), nil
+}
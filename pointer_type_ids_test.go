@@ -0,0 +1,75 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type pointerTypeIDsSample struct {
+	A int
+}
+
+func TestPointerBehindInterface(t *testing.T) {
+	type holder struct {
+		V any
+	}
+
+	t.Run("pointer_aware_handler", func(t *testing.T) {
+		typeIDHandler := typeIDHandlerT{}
+		for _, obj := range []holder{
+			{V: &CalculatorLinear{K: 1}},
+			{V: CalculatorLinear{K: 1}},
+		} {
+			b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+			require.NoError(t, err)
+
+			var result holder
+			require.NoError(t, UnmarshalWithTypeIDs(b, &result, typeIDHandler))
+			require.Equal(t, obj, result)
+		}
+	})
+
+	t.Run("registry", func(t *testing.T) {
+		isolateTypeRegistry(t)
+		RegisterType(pointerTypeIDsSample{})
+		sample := &pointerTypeIDsSample{A: 1}
+		sampleRef := &sample
+
+		b, err := MarshalWithTypeIDs(holder{V: sample}, TypeRegistry())
+		require.NoError(t, err)
+		require.Equal(t, `{"V":{"pointerTypeIDsSample":{"A":1}}}`, string(b))
+
+		var result holder
+		require.NoError(t, UnmarshalWithTypeIDs(b, &result, TypeRegistry()))
+		require.Equal(t, holder{V: pointerTypeIDsSample{A: 1}}, result)
+
+		for _, obj := range []holder{
+			{V: sample},
+			{V: sampleRef},
+			{V: pointerTypeIDsSample{A: 1}},
+		} {
+			b, err := MarshalWithTypeIDs(obj, TypeRegistry(), WithPointerTypeIDs(true))
+			require.NoError(t, err)
+
+			var result holder
+			require.NoError(t, UnmarshalWithTypeIDs(b, &result, TypeRegistry(), WithPointerTypeIDs(true)))
+			require.Equal(t, obj, result)
+		}
+
+		b, err = MarshalWithTypeIDs(holder{V: sampleRef}, TypeRegistry(), WithPointerTypeIDs(true))
+		require.NoError(t, err)
+		require.Equal(t, `{"V":{"**pointerTypeIDsSample":{"A":1}}}`, string(b))
+	})
+}
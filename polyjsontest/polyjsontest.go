@@ -0,0 +1,52 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package polyjsontest provides helpers to test (un)marshaling
+// of polymorphic types with package polyjson.
+package polyjsontest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/polyjson"
+)
+
+// AssertRoundTrip marshals the value with polyjson.MarshalWithTypeIDs,
+// compares the result with the expected JSON (ignoring formatting and the
+// order of keys), unmarshals it back into a new value of the same type
+// and deep-compares it with the original value.
+//
+// To test a value behind an interface, pass a pointer to the interface:
+//
+//	var calc Calculator = CalculatorLinear{K: 1}
+//	polyjsontest.AssertRoundTrip(t, &calc, `{"CalculatorLinear":{"K":1}}`, polyjson.TypeRegistry())
+func AssertRoundTrip(
+	t testing.TB,
+	value any,
+	expectedJSON string,
+	handler polyjson.TypeIDHandler,
+	opts ...polyjson.Option,
+) {
+	t.Helper()
+	require.NotNil(t, value, "the value must not be an untyped nil")
+
+	b, err := polyjson.MarshalWithTypeIDs(value, handler, opts...)
+	require.NoError(t, err, "unable to marshal")
+	require.JSONEq(t, expectedJSON, string(b))
+
+	cpy := reflect.New(reflect.TypeOf(value))
+	err = polyjson.UnmarshalWithTypeIDs(b, cpy.Interface(), handler, opts...)
+	require.NoError(t, err, "unable to unmarshal %s", b)
+	require.Equal(t, value, cpy.Elem().Interface())
+}
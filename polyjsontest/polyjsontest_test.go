@@ -0,0 +1,47 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjsontest_test
+
+import (
+	"testing"
+
+	"github.com/xaionaro-go/polyjson"
+	"github.com/xaionaro-go/polyjson/polyjsontest"
+)
+
+type shape interface {
+	Area() float64
+}
+
+type Square struct {
+	Side float64
+}
+
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+type Drawing struct {
+	Shapes []shape
+	Main   shape
+}
+
+func TestAssertRoundTrip(t *testing.T) {
+	polyjson.RegisterTypeAs("Square", Square{})
+
+	polyjsontest.AssertRoundTrip(t, Drawing{
+		Shapes: []shape{Square{Side: 1}, nil},
+		Main:   Square{Side: 2},
+	}, `{"Main":{"Square":{"Side":2}},"Shapes":[{"Square":{"Side":1}},null]}`, polyjson.TypeRegistry())
+
+	var main shape = Square{Side: 3}
+	polyjsontest.AssertRoundTrip(t, &main, `{"Square":{"Side":3}}`, polyjson.TypeRegistry())
+}
@@ -0,0 +1,100 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Releaser is a NewByTypeIDer, which could reuse the values it returned
+// (for example, see Pool).
+//
+// UnmarshalWithTypeIDs releases the values it does not retain by itself:
+// a value of an interface is normally stored as a copy of the constructed
+// value (not as the pointer returned by NewByTypeID).
+type Releaser interface {
+	// Release returns the value (a pointer returned by NewByTypeID)
+	// to be reused. The value should not be used after the call.
+	Release(value any)
+}
+
+// Pool is a NewByTypeIDer (and a Releaser), which reuses the released values
+// instead of allocating new ones (through sync.Pool per each type).
+// It is intended for hot decoding paths.
+//
+// Lifetime rules:
+//   - A value stored in an interface by value (for example CalculatorLinear)
+//     is a copy, so the constructed variable is released automatically.
+//   - A value stored in an interface by pointer (for example *CalculatorConst)
+//     is owned by the caller, and it could be returned by Release when
+//     it is not referenced anymore (including by the decoded document).
+//     After Release the value is zeroed and may be returned by any subsequent
+//     decoding, so any further use of the value is a use-after-release bug.
+//   - Reused values are zeroed, so Pool should not wrap a NewByTypeIDer,
+//     which returns pre-filled values (see RegisterInstance).
+type Pool struct {
+	newByTypeIDer NewByTypeIDer
+
+	// types is a map of TypeID to the type of values returned for it.
+	types sync.Map
+	// pools is a map of a pointer type to *sync.Pool of values of it.
+	pools sync.Map
+}
+
+var _ Releaser = (*Pool)(nil)
+
+// NewPool returns a new Pool, which constructs new values through
+// the given NewByTypeIDer.
+func NewPool(newByTypeIDer NewByTypeIDer) *Pool {
+	return &Pool{
+		newByTypeIDer: newByTypeIDer,
+	}
+}
+
+// NewByTypeID implements NewByTypeIDer.
+func (p *Pool) NewByTypeID(typeID TypeID) (any, error) {
+	if t, ok := p.types.Load(typeID); ok {
+		if pool, ok := p.pools.Load(t); ok {
+			if value := pool.(*sync.Pool).Get(); value != nil {
+				return value, nil
+			}
+		}
+	}
+
+	value, err := p.newByTypeIDer.NewByTypeID(typeID)
+	if err != nil || value == nil {
+		return value, err
+	}
+	p.types.Store(typeID, reflect.TypeOf(value))
+	return value, nil
+}
+
+// Release implements Releaser. Values other than non-nil pointers are ignored.
+func (p *Pool) Release(value any) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return
+	}
+	v.Elem().SetZero()
+
+	pool, _ := p.pools.LoadOrStore(v.Type(), &sync.Pool{})
+	pool.(*sync.Pool).Put(value)
+}
+
+// release returns the value constructed by the NewByTypeIDer (and not
+// retained by the decoded document) back to it, if it is a Releaser.
+func (u *unmarshaler) release(value any) {
+	if releaser, ok := u.newByTypeIDer.(Releaser); ok {
+		releaser.Release(value)
+	}
+}
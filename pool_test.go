@@ -0,0 +1,43 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	pool := NewPool(typeIDHandlerT{})
+	b, err := MarshalWithTypeIDs([]Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}}, typeIDHandlerT{})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		var cpy []Calculator
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, pool))
+		require.Equal(t, []Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}}, cpy)
+
+		// the pointer is retained by the document, so it is released by the caller
+		released := cpy[1].(*CalculatorConst)
+		pool.Release(released)
+		require.Equal(t, CalculatorConst{}, *released)
+	}
+
+	// reused values are zeroed, so nothing leaks from the previous documents
+	var cpy []Calculator
+	require.NoError(t, UnmarshalWithTypeIDs([]byte(`[{"github.com/xaionaro-go/polyjson.CalculatorLinear":{}},{"*github.com/xaionaro-go/polyjson.CalculatorConst":{}}]`), &cpy, pool))
+	require.Equal(t, []Calculator{CalculatorLinear{}, &CalculatorConst{}}, cpy)
+
+	_, err = pool.NewByTypeID("unknown")
+	require.Error(t, err)
+}
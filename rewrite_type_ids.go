@@ -0,0 +1,97 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// RewriteTypeIDs returns the document with the TypeIDs of type-tagged
+// values (`{TypeID:content}`) replaced according to the mapping, without
+// decoding the document into Go types. It allows to migrate stored
+// documents after types are renamed (see also RegisterTypeAlias).
+//
+// Any single-key object, which key is in the mapping, is considered
+// a type-tagged value (or any 2-item array, which first item is in the mapping,
+// if the format is FormatTupleArray, see WithFormat). The order of keys
+// is preserved, while insignificant whitespace is removed.
+func RewriteTypeIDs(b []byte, mapping map[TypeID]TypeID, opts ...Option) ([]byte, error) {
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("the document is not a valid JSON")
+	}
+
+	u := &unmarshaler{config: Options(opts).config()}
+	var buf bytes.Buffer
+	if err := u.rewriteTypeIDs(&buf, gjson.ParseBytes(b), mapping); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (u *unmarshaler) rewriteTypeIDs(buf *bytes.Buffer, value gjson.Result, mapping map[TypeID]TypeID) error {
+	if key, content, count := u.unpackWrapper(value); count == 1 {
+		if newTypeID, ok := mapping[TypeID(key)]; ok {
+			var contentBuf bytes.Buffer
+			if err := u.rewriteTypeIDs(&contentBuf, content, mapping); err != nil {
+				return err
+			}
+			m := &marshaler{config: u.config}
+			wrapper, err := m.marshalWrapper(newTypeID, contentBuf.Bytes())
+			if err != nil {
+				return err
+			}
+			buf.Write(wrapper)
+			return nil
+		}
+	}
+
+	switch {
+	case value.IsObject():
+		var err error
+		buf.WriteByte('{')
+		first := true
+		value.ForEach(func(key, item gjson.Result) bool {
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			buf.WriteString(key.Raw)
+			buf.WriteByte(':')
+			err = u.rewriteTypeIDs(buf, item, mapping)
+			return err == nil
+		})
+		buf.WriteByte('}')
+		return err
+	case value.IsArray():
+		var err error
+		buf.WriteByte('[')
+		first := true
+		value.ForEach(func(_, item gjson.Result) bool {
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			err = u.rewriteTypeIDs(buf, item, mapping)
+			return err == nil
+		})
+		buf.WriteByte(']')
+		return err
+	default:
+		buf.WriteString(value.Raw)
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ScanTypeIDs returns the TypeIDs (sorted, without duplicates) of all the
+// type-tagged values (`{TypeID:content}`) of the document, without
+// constructing any values. It allows, for example, to check that the document
+// references only an allowed set of types before decoding it.
+//
+// Since the document has no schema, a single-key object is considered
+// type-tagged if the key is registered in the type registry (see RegisterType
+// and RegisterTypeAlias), or if it looks like a qualified TypeID (contains
+// a dot, or starts with "*"). So TypeIDs of custom handlers without a dot
+// (for example "linear") are not detected.
+//
+// The type-tagged values are recognized according to the options
+// (see WithFormat).
+func ScanTypeIDs(b []byte, opts ...Option) ([]TypeID, error) {
+	if !gjson.ValidBytes(b) {
+		return nil, fmt.Errorf("invalid JSON")
+	}
+
+	u := &unmarshaler{config: Options(opts).config()}
+	found := map[TypeID]struct{}{}
+	u.scanTypeIDs(gjson.ParseBytes(b), found)
+
+	result := make([]TypeID, 0, len(found))
+	for typeID := range found {
+		result = append(result, typeID)
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+func (u *unmarshaler) scanTypeIDs(value gjson.Result, found map[TypeID]struct{}) {
+	if key, content, count := u.unpackWrapper(value); count == 1 && looksLikeTypeID(key) {
+		found[TypeID(key)] = struct{}{}
+		u.scanTypeIDs(content, found)
+		return
+	}
+	if value.IsObject() || value.IsArray() {
+		value.ForEach(func(_, item gjson.Result) bool {
+			u.scanTypeIDs(item, found)
+			return true
+		})
+	}
+}
+
+// looksLikeTypeID returns true if the key of a single-key object
+// is considered a TypeID (see ScanTypeIDs).
+func looksLikeTypeID(key string) bool {
+	if strings.Contains(key, ".") || strings.HasPrefix(key, "*") {
+		return true
+	}
+	if _, ok := typeRegistry[TypeID(key)]; ok {
+		return true
+	}
+	_, ok := typeAliases[TypeID(key)]
+	return ok
+}
@@ -0,0 +1,61 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanTypeIDs(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(CalculatorLinear{})
+	type doc struct {
+		Calculators []Calculator
+		Nested      map[string]any
+		Plain       Struct3
+	}
+	obj := doc{
+		Calculators: []Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}, CalculatorLinear{K: 3}, nil},
+		Nested:      map[string]any{"a": map[string]any{"b": CalculatorLinear{K: 4}}},
+		Plain:       Struct3{Int2: 5},
+	}
+	b, err := MarshalWithTypeIDs(obj, typeIDHandlerT{})
+	require.NoError(t, err)
+
+	typeIDs, err := ScanTypeIDs(b)
+	require.NoError(t, err)
+	require.Equal(t, []TypeID{
+		"*github.com/xaionaro-go/polyjson.CalculatorConst",
+		".", // the unnamed map[string]any nested into map[string]any
+		"github.com/xaionaro-go/polyjson.CalculatorLinear",
+	}, typeIDs)
+
+	// a registered TypeID is detected even without a dot, while other single-key objects are not
+	typeIDs, err = ScanTypeIDs([]byte(`{"a":{"CalculatorLinear":{"K":1}},"b":{"K":2}}`))
+	require.NoError(t, err)
+	require.Equal(t, []TypeID{"CalculatorLinear"}, typeIDs)
+
+	b, err = MarshalWithTypeIDs(obj, typeIDHandlerT{}, WithFormat(FormatTupleArray))
+	require.NoError(t, err)
+	tupleTypeIDs, err := ScanTypeIDs(b, WithFormat(FormatTupleArray))
+	require.NoError(t, err)
+	require.Equal(t, []TypeID{
+		"*github.com/xaionaro-go/polyjson.CalculatorConst",
+		".",
+		"github.com/xaionaro-go/polyjson.CalculatorLinear",
+	}, tupleTypeIDs)
+
+	_, err = ScanTypeIDs([]byte(`{`))
+	require.Error(t, err)
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// SetTyped replaces the value at the gjson path (for example
+// "Plugins.1.Calculator") in the document b with the value marshaled
+// with its TypeID (`{TypeID:content}`, the same as a value of
+// an interface is marshaled), and returns the modified document.
+// The rest of the document is kept byte-for-byte as is.
+//
+// It allows to edit a stored polymorphic document without decoding it.
+// The path should lead to a single existing value (queries, multipaths
+// and modifiers are not supported), otherwise ErrPathNotFound is returned.
+func SetTyped(b []byte, path string, value any, typeIDOfer TypeIDOfer, opts ...Option) ([]byte, error) {
+	if !gjson.ValidBytes(b) {
+		return nil, fmt.Errorf("the document is not a valid JSON")
+	}
+	result := gjson.GetBytes(b, path)
+	if !result.Exists() {
+		return nil, ErrPathNotFound{Path: path}
+	}
+	start, end := result.Index, result.Index+len(result.Raw)
+	if end > len(b) || string(b[start:end]) != result.Raw {
+		// the value is synthesized by gjson (for example, by a query),
+		// so it has no location in the document
+		return nil, ErrPathNotFound{Path: path}
+	}
+
+	m := &marshaler{
+		typeIDOfer: typeIDOfer,
+		config:     Options(opts).config(),
+	}
+	valueBytes, err := m.marshalAny(value, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal the value for path '%s': %w", path, err)
+	}
+
+	out := make([]byte, 0, len(b)-len(result.Raw)+len(valueBytes))
+	out = append(out, b[:start]...)
+	out = append(out, valueBytes...)
+	out = append(out, b[end:]...)
+	return out, nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTyped(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	doc := []byte(`{"Name": "x", "Calculators": [{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}, null]}`)
+
+	b, err := SetTyped(doc, "Calculators.1", &CalculatorConst{C: 2}, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Name": "x", "Calculators": [{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}, {"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}}]}`, string(b))
+
+	var cpy struct {
+		Name        string
+		Calculators []Calculator
+	}
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+	require.Equal(t, []Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}}, cpy.Calculators)
+
+	b, err = SetTyped(b, "Calculators.0", nil, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Name": "x", "Calculators": [null, {"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}}]}`, string(b))
+
+	t.Run("not_found", func(t *testing.T) {
+		for _, path := range []string{"Missing", "Calculators.5", "Calculators.#.K"} {
+			_, err := SetTyped(doc, path, CalculatorLinear{}, typeIDHandler)
+			require.ErrorAs(t, err, &ErrPathNotFound{}, path)
+		}
+	})
+
+	t.Run("invalid_document", func(t *testing.T) {
+		_, err := SetTyped([]byte(`{"a":`), "a", CalculatorLinear{}, typeIDHandler)
+		require.Error(t, err)
+	})
+}
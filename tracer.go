@@ -0,0 +1,46 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+// Tracer observes the TypeID resolution decisions (see WithTracer).
+// It is intended for debugging complex documents.
+type Tracer interface {
+	// OnField is called for every interface value at the given path
+	// with the TypeID it is marshaled with or unmarshaled from.
+	//
+	// On unmarshal the TypeID is empty if the concrete type is determined
+	// without a TypeID (see RegisterDefaultImpl and WithLenient).
+	OnField(path string, typeID TypeID)
+}
+
+type optionTracer struct {
+	Tracer Tracer
+}
+
+func (opt optionTracer) apply(cfg *config) {
+	cfg.Tracer = opt.Tracer
+}
+
+// WithTracer makes MarshalWithTypeIDs and UnmarshalWithTypeIDs to report
+// the TypeIDs of interface values to the given tracer.
+func WithTracer(tracer Tracer) Option {
+	return optionTracer{Tracer: tracer}
+}
+
+// trace reports the TypeID to the tracer (if any).
+func (cfg *config) trace(path valuePath, typeID TypeID) {
+	if cfg.Tracer == nil {
+		return
+	}
+	cfg.Tracer.OnField(path.String(), typeID)
+}
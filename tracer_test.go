@@ -0,0 +1,51 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingTracer []string
+
+func (r *recordingTracer) OnField(path string, typeID TypeID) {
+	*r = append(*r, path+"="+string(typeID))
+}
+
+func TestTracer(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	obj := []Strategy{
+		{Name: "linear", Calculator: CalculatorLinear{K: 1}},
+		{Name: "const", Calculator: &CalculatorConst{C: 2}},
+		{Name: "none"},
+	}
+
+	var marshalTrace recordingTracer
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler, WithTracer(&marshalTrace))
+	require.NoError(t, err)
+	require.Equal(t, recordingTracer{
+		"$[0].Calculator=github.com/xaionaro-go/polyjson.CalculatorLinear",
+		"$[1].Calculator=*github.com/xaionaro-go/polyjson.CalculatorConst",
+	}, marshalTrace)
+
+	var (
+		unmarshalTrace recordingTracer
+		cpy            []Strategy
+	)
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithTracer(&unmarshalTrace))
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+	require.Equal(t, marshalTrace, unmarshalTrace)
+}
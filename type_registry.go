@@ -14,15 +14,50 @@
 package polyjson
 
 import (
+	"fmt"
+	"go/token"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type typeRegistryT map[TypeID]reflect.Type
 
 var (
 	typeRegistry = typeRegistryT{}
+
+	// typeIDs is the reverse of typeRegistry: a map of registered types to their TypeIDs.
+	typeIDs = map[reflect.Type]TypeID{}
+
+	// typeAliases is a map of alternative TypeIDs (for example, old names
+	// of renamed types) to types (see RegisterTypeAlias).
+	typeAliases = map[TypeID]reflect.Type{}
+
+	// defaultImpls is a map of interface type to the type to be used
+	// if the TypeID is absent (see RegisterDefaultImpl).
+	defaultImpls = map[reflect.Type]reflect.Type{}
+
+	// defaultSliceItemImpls is a map of slice type to the type to be used
+	// for its items if the TypeID is absent (see RegisterDefaultSliceItemImpl).
+	defaultSliceItemImpls = map[reflect.Type]reflect.Type{}
+
+	// stringifiedNumberTypes is a set of numeric types, which values are
+	// stored as JSON strings (see RegisterStringifiedNumberType).
+	stringifiedNumberTypes = map[reflect.Type]struct{}{}
+
+	// instances is a map of TypeIDs to the values to be cloned
+	// by NewByTypeID (see RegisterInstance).
+	instances = map[TypeID]reflect.Value{}
+
+	// instanceIDs is a map of instances given as pointers
+	// to their TypeIDs (see RegisterInstance).
+	instanceIDs = map[any]TypeID{}
+
+	// interfaceStorages is a map of types to the way their decoded values
+	// are stored in interfaces (see RegisterInterfaceStorage).
+	interfaceStorages = map[reflect.Type]InterfaceStorage{}
 )
 
 // TypeRegistry returns the TypeIDHandler
@@ -33,49 +68,468 @@ func TypeRegistry() TypeIDHandler {
 // RegisterType registers the type of the provided sample into
 // the registry. It allows to deserialize JSONs into typed values.
 //
-// The sample may also be given as a (nil) pointer.
+// The TypeID is derived from the path and the name of the type,
+// unless it is declared by the structure through a blank marker field:
+//
+//	type myFancyStruct struct {
+//	    _ struct{} `polyjson:"id=myFancyStruct"`
+//	    A int
+//	}
+//
+// Named non-struct types (for example `type Dict map[string]any`) are
+// registered the same way. Unnamed types (for example map[string]string)
+// have no meaningful derived TypeID, so they should be registered
+// through RegisterTypeAs.
+//
+// The sample may also be given as a (nil) pointer. Values and pointers
+// share the TypeID: TypeIDOf returns the same TypeID for Foo{} and &Foo{},
+// and NewByTypeID returns a *Foo (see also WithPointerTypeIDs).
 func RegisterType(sample any) {
+	RegisterTypeWithPrefix("", sample)
+}
+
+// RegisterTypeWithPrefix is the same as RegisterType, but the derived
+// TypeID is prefixed with the given prefix (for example "myapp/"),
+// to avoid collisions of TypeIDs of different modules.
+//
+// A TypeID declared by the structure (see RegisterType) is used as is.
+func RegisterTypeWithPrefix(prefix string, sample any) {
 	t := typeOf(sample)
-	typeRegistry[typeToID(t)] = t
+	id, ok := typeIDFromTag(t)
+	if !ok {
+		id = TypeID(prefix) + typeToID(t)
+	}
+	RegisterTypeAs(id, sample)
+}
+
+// RegisterTypes registers the types of all the provided samples (see RegisterType).
+//
+// It is handy for generic types: Go cannot instantiate a generic type
+// through reflection, so each instantiation has to be given as a sample:
+//
+//	polyjson.RegisterTypes(MAMA[float64]{}, MAMA[int]{})
+//
+// The TypeID of an instantiation includes its type arguments,
+// for example "./avpipeline/indicator.MAMA[float64]".
+func RegisterTypes(samples ...any) {
+	for _, sample := range samples {
+		RegisterType(sample)
+	}
+}
+
+// RegisterTypeAs registers the type of the provided sample into
+// the registry with the given TypeID (instead of the derived one, see RegisterType).
+//
+// The sample may also be given as a (nil) pointer.
+func RegisterTypeAs(id TypeID, sample any) {
+	t := typeOf(sample)
+	typeRegistry[id] = t
+	typeIDs[t] = id
+	delete(instances, id)
+	soleImplementationCache.Clear()
+}
+
+// RegisterInstance registers the specific value with the given TypeID:
+// NewByTypeID returns a pointer to a shallow copy of the instance (to be
+// filled by the decoded document). It allows to register dynamically
+// created implementations, for example an adapter structure with
+// a closure in an unexported field:
+//
+//	polyjson.RegisterInstance("double", &calculatorFunc{fn: func(x float64) float64 { return x * 2 }})
+//
+// If the instance is given as a pointer, then TypeIDOf recognizes this exact
+// pointer even if multiple instances of the same type are registered.
+// Otherwise (and for copies, including decoded values) TypeIDOf returns
+// the TypeID of the instance only if it is the only registered instance
+// of the type, and ErrAmbiguousInstance if there are multiple of them.
+func RegisterInstance(id TypeID, instance any) {
+	v := reflect.ValueOf(instance)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			panic(fmt.Errorf("expected a non-nil instance, but got %T(nil)", instance))
+		}
+		instanceIDs[v.Interface()] = id
+		v = v.Elem()
+	}
+	RegisterTypeAs(id, instance)
+	instances[id] = v
+}
+
+// instanceTypeIDs returns the TypeIDs (sorted) of the instances
+// of the given type (see RegisterInstance).
+func instanceTypeIDs(t reflect.Type) []TypeID {
+	var result []TypeID
+	for id, instance := range instances {
+		if instance.Type() == t {
+			result = append(result, id)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// typeIDFromTag returns the TypeID declared through the `polyjson:"id=..."`
+// tag of a blank marker field of the structure.
+func typeIDFromTag(t reflect.Type) (TypeID, bool) {
+	if t.Kind() != reflect.Struct {
+		return "", false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		fT := t.Field(i)
+		if fT.Name != "_" {
+			continue
+		}
+		if id, ok := parsePolyjsonTag(fT)["id"]; ok && id != "" {
+			return TypeID(id), true
+		}
+	}
+	return "", false
+}
+
+// RegisterTypeAlias registers an alternative TypeID for the type of the provided
+// sample. The alias is accepted by NewByTypeID, while TypeIDOf still returns
+// the primary TypeID. It allows to decode documents written with an old TypeID
+// (for example, before the type was renamed or moved).
+//
+// The sample may also be given as a (nil) pointer.
+func RegisterTypeAlias(alias TypeID, sample any) {
+	typeAliases[alias] = typeOf(sample)
+}
+
+// RegisterDefaultImpl registers the type of the provided sample as the
+// default implementation of the interface, which is pointed to by ifacePtr.
+//
+// It is used to decode interface values without the TypeID wrapper
+// (for example, in legacy documents) if WithLenient is enabled.
+//
+// For example:
+//
+//	polyjson.RegisterDefaultImpl((*Calculator)(nil), DefaultCalculator{})
+func RegisterDefaultImpl(ifacePtr any, sample any) {
+	ifaceType := interfaceTypeOf(ifacePtr)
+	defaultImpls[ifaceType] = implTypeOf(ifaceType, sample)
+}
+
+// interfaceTypeOf returns the interface type pointed to by ifacePtr.
+func interfaceTypeOf(ifacePtr any) reflect.Type {
+	ifaceType := reflect.TypeOf(ifacePtr)
+	if ifaceType == nil || ifaceType.Kind() != reflect.Pointer || ifaceType.Elem().Kind() != reflect.Interface {
+		panic(fmt.Errorf("expected a pointer to an interface, but got %T", ifacePtr))
+	}
+	return ifaceType.Elem()
+}
+
+// RegisterDefaultSliceItemImpl registers the type of the provided sample as the
+// default implementation of the items of the slice of interfaces, which is
+// pointed to by slicePtr. It takes precedence over RegisterDefaultImpl
+// for items of this slice type.
+//
+// It is used to decode legacy arrays without the TypeID wrappers
+// if WithLenient is enabled.
+//
+// For example:
+//
+//	polyjson.RegisterDefaultSliceItemImpl((*[]Plugin)(nil), DefaultPlugin{})
+func RegisterDefaultSliceItemImpl(slicePtr any, sample any) {
+	sliceType := reflect.TypeOf(slicePtr)
+	if sliceType == nil || sliceType.Kind() != reflect.Pointer ||
+		sliceType.Elem().Kind() != reflect.Slice || sliceType.Elem().Elem().Kind() != reflect.Interface {
+		panic(fmt.Errorf("expected a pointer to a slice of interfaces, but got %T", slicePtr))
+	}
+	sliceType = sliceType.Elem()
+
+	defaultSliceItemImpls[sliceType] = implTypeOf(sliceType.Elem(), sample)
+}
+
+func implTypeOf(ifaceType reflect.Type, sample any) reflect.Type {
+	t := typeOf(sample)
+	if !t.Implements(ifaceType) && !reflect.PointerTo(t).Implements(ifaceType) {
+		panic(fmt.Errorf("neither %s nor %s implements %s", t, reflect.PointerTo(t), ifaceType))
+	}
+	return t
+}
+
+// ImplementationsOf returns the TypeIDs (sorted) of all the registered types,
+// which implement (by value or by pointer) the interface pointed to by ifacePtr.
+// It allows, for example, to list the choices for a polymorphic field in a UI:
+//
+//	polyjson.ImplementationsOf((*Calculator)(nil))
+//
+// Aliases (see RegisterTypeAlias) are not included.
+func ImplementationsOf(ifacePtr any) []TypeID {
+	return implementationTypeIDs(interfaceTypeOf(ifacePtr))
+}
+
+// implementationTypeIDs returns the TypeIDs (sorted) of the registered types,
+// which implement the interface (by value or by pointer).
+func implementationTypeIDs(ifaceType reflect.Type) []TypeID {
+	var result []TypeID
+	for _, typeID := range typeRegistry.TypeIDs() {
+		t, ok := typeRegistry[typeID]
+		if !ok {
+			// an alias
+			continue
+		}
+		if t.Implements(ifaceType) || reflect.PointerTo(t).Implements(ifaceType) {
+			result = append(result, typeID)
+		}
+	}
+	return result
+}
+
+// registeredImplementations returns the registered types (sorted by TypeID),
+// which implement the interface (by value or by pointer).
+func registeredImplementations(ifaceType reflect.Type) []reflect.Type {
+	var result []reflect.Type
+	for _, typeID := range implementationTypeIDs(ifaceType) {
+		result = append(result, typeRegistry[typeID])
+	}
+	return result
+}
+
+// soleImplementationCache is a cache of interface types to the results
+// of soleImplementation (nil if there is no sole implementation).
+// It is reset on every registration of a type.
+var soleImplementationCache sync.Map
+
+// soleImplementation returns the type of values to be stored in the interface
+// if there is exactly one registered type implementing it: the type itself,
+// or the pointer to it (if only the pointer implements the interface).
+//
+// The empty interface never has a sole implementation: any value
+// (including a JSON scalar) could be stored in it.
+func soleImplementation(ifaceType reflect.Type) (reflect.Type, bool) {
+	if ifaceType.NumMethod() == 0 {
+		return nil, false
+	}
+	if result, ok := soleImplementationCache.Load(ifaceType); ok {
+		impl, _ := result.(reflect.Type)
+		return impl, impl != nil
+	}
+
+	var impl reflect.Type
+	switch impls := registeredImplementations(ifaceType); {
+	case len(impls) != 1:
+	case impls[0].Implements(ifaceType):
+		impl = impls[0]
+	default:
+		impl = reflect.PointerTo(impls[0])
+	}
+	soleImplementationCache.Store(ifaceType, impl)
+	return impl, impl != nil
+}
+
+// soleImplementation is the same as the function soleImplementation,
+// but only if the TypeIDOfer is the type registry (the implementations
+// known to other TypeIDOfers are unknown).
+func (m *marshaler) soleImplementation(ifaceType reflect.Type) (reflect.Type, bool) {
+	if _, ok := m.typeIDOfer.(typeRegistryT); !ok {
+		return nil, false
+	}
+	return soleImplementation(ifaceType)
+}
+
+// soleImplementation is the same as the function soleImplementation,
+// but only if the NewByTypeIDer is the type registry (the implementations
+// known to other NewByTypeIDers are unknown).
+func (u *unmarshaler) soleImplementation(ifaceType reflect.Type) (reflect.Type, bool) {
+	if _, ok := u.newByTypeIDer.(typeRegistryT); !ok {
+		return nil, false
+	}
+	return soleImplementation(ifaceType)
+}
+
+// RegisterStringifiedNumberType makes every structure field of the numeric
+// type of the provided sample to be stored as a JSON string, the same
+// as if all such fields were tagged with option "string".
+//
+// For example:
+//
+//	type BigID int64
+//	polyjson.RegisterStringifiedNumberType(BigID(0))
+func RegisterStringifiedNumberType(sample any) {
+	t := reflect.TypeOf(sample)
+	if !isNumeric(t) {
+		panic(fmt.Errorf("expected a numeric type, but got %s", t))
+	}
+	stringifiedNumberTypes[t] = struct{}{}
+
+	// values of this type could no longer be handled by "encoding/json" directly
+	needsWalkCache.Clear()
+}
+
+// InterfaceStorage defines the dynamic type of a decoded value stored
+// in an interface (see RegisterInterfaceStorage).
+type InterfaceStorage int
+
+const (
+	// InterfaceStorageAuto stores T if T implements the interface,
+	// and *T otherwise. This is the default.
+	InterfaceStorageAuto = InterfaceStorage(iota)
+
+	// InterfaceStorageByValue always stores T (it is an error to decode
+	// into an interface, which is implemented only by *T).
+	InterfaceStorageByValue
+
+	// InterfaceStorageByPointer always stores *T (even if T
+	// implements the interface by value).
+	InterfaceStorageByPointer
+)
+
+// RegisterInterfaceStorage defines whether the decoded values of the type
+// of the provided sample are stored in interfaces by value (T) or
+// by pointer (*T), for example:
+//
+//	polyjson.RegisterInterfaceStorage(Foo{}, polyjson.InterfaceStorageByPointer)
+//
+// makes UnmarshalWithTypeIDs to store a *Foo into an interface field
+// of type "any" (instead of a Foo).
+//
+// The sample may also be given as a (nil) pointer.
+func RegisterInterfaceStorage(sample any, storage InterfaceStorage) {
+	interfaceStorages[typeOf(sample)] = storage
 }
 
 // IsRegisteredType returns true if the type of the provided sample
 // is already registered (and could be used in analyzer input/output).
 func IsRegisteredType(sample any) bool {
-	_, ok := typeRegistry[typeIDOf(sample)]
+	_, ok := typeIDs[typeOf(sample)]
 	return ok
 }
 
 var (
 	// AutoRegisterTypes automatically registers new types in the
 	// type registry on an attempt to get TypeID of an unregistered
-	// sample.
+	// sample. Unexported and unnamed types are never registered
+	// automatically (see ErrUnexportedType).
 	AutoRegisterTypes = false
 )
 
+// typeIDSettings defines how TypeIDs are derived from types (see RegisterType).
+var typeIDSettings = struct {
+	sync.RWMutex
+	fullTypeIDs         bool
+	genericTypeIDFormat TypeArgsFormat
+}{
+	genericTypeIDFormat: TypeArgsFormat{Open: "[", Separator: ",", Close: "]"},
+}
+
+// SetFullTypeIDs makes the derived TypeIDs (see RegisterType) to always
+// use the full import path of the package (for example
+// "github.com/my/app/pkg.Foo"), instead of the shortened forms
+// (for example "Foo" for types of this package, or "./app/pkg.Foo"
+// for packages next to it).
+//
+// Such TypeIDs are stable across independently built binaries,
+// which may vendor the same package differently, but they are longer,
+// and they change if the package is moved (see RegisterTypeAlias).
+// Switching the mode changes the TypeIDs of already stored documents,
+// so it should be set (before registering types) once per project.
+func SetFullTypeIDs(enable bool) {
+	typeIDSettings.Lock()
+	defer typeIDSettings.Unlock()
+	typeIDSettings.fullTypeIDs = enable
+}
+
+// fullTypeIDs returns the value set by SetFullTypeIDs.
+func fullTypeIDs() bool {
+	typeIDSettings.RLock()
+	defer typeIDSettings.RUnlock()
+	return typeIDSettings.fullTypeIDs
+}
+
+// SetGenericTypeIDFormat defines how the type arguments of instantiations
+// of generic types are rendered in the derived TypeIDs (see RegisterTypes),
+// for example TypeArgsFormat{Open: "_", Separator: "_", Close: "_"}
+// renders "MAMA_float64_" instead of "MAMA[float64]" (for systems, which
+// cannot handle brackets in identifiers). The default format
+// is TypeArgsFormat{Open: "[", Separator: ",", Close: "]"}.
+//
+// The TypeIDs are still decoded by the registry as is, but the format should
+// keep them unique. It should be set before registering types.
+func SetGenericTypeIDFormat(format TypeArgsFormat) {
+	typeIDSettings.Lock()
+	defer typeIDSettings.Unlock()
+	typeIDSettings.genericTypeIDFormat = format
+}
+
+// genericTypeIDFormat returns the value set by SetGenericTypeIDFormat.
+func genericTypeIDFormat() TypeArgsFormat {
+	typeIDSettings.RLock()
+	defer typeIDSettings.RUnlock()
+	return typeIDSettings.genericTypeIDFormat
+}
+
+// TypeArgsFormat is a set of delimiters of type arguments in TypeIDs
+// (see SetGenericTypeIDFormat).
+type TypeArgsFormat struct {
+	Open      string
+	Separator string
+	Close     string
+}
+
+// typeName returns the name of the type, where the type arguments
+// (if any) are formatted according to SetGenericTypeIDFormat.
+func typeName(t reflect.Type) string {
+	name := t.Name()
+	idx := strings.IndexByte(name, '[')
+	if idx < 0 {
+		return name
+	}
+	format := genericTypeIDFormat()
+	return name[:idx] + strings.NewReplacer(
+		"[", format.Open,
+		",", format.Separator,
+		"]", format.Close,
+	).Replace(name[idx:])
+}
+
+// PolyTyper is a type which can define its own TypeID (see WithPolyTypeFallback).
+type PolyTyper interface {
+	PolyType() string
+}
+
 // TypeIDOf returns TypeID of the type of the given sample.
 func (typeRegistryT) TypeIDOf(sample any) (TypeID, error) {
-	id := typeIDOf(sample)
+	t := typeOf(sample)
 
-	if IsRegisteredType(sample) {
+	if reflect.TypeOf(sample).Kind() == reflect.Pointer {
+		if id, ok := instanceIDs[sample]; ok {
+			return id, nil
+		}
+	}
+	if id, ok := typeIDs[t]; ok {
+		if _, isInstance := instances[id]; isInstance {
+			if candidates := instanceTypeIDs(t); len(candidates) > 1 {
+				return "", ErrAmbiguousInstance{Type: t, Candidates: candidates}
+			}
+		}
 		return id, nil
 	}
 	if !AutoRegisterTypes {
-		return "", ErrTypeIDNotRegistered{TypeID: id}
+		return "", ErrTypeIDNotRegistered{TypeID: typeToID(t)}
+	}
+	if !isExportedType(t) {
+		return "", ErrUnexportedType{Type: t}
 	}
 
 	RegisterType(sample)
-	return id, nil
-}
-
-func typeIDOf(sample any) TypeID {
-	t := typeOf(sample)
-	return typeToID(t)
+	return typeIDs[t], nil
 }
 
 // NewByTypeID returns a pointer to a value with a type, defined
+// by the TypeID (or by its alias, see RegisterTypeAlias).
 func (r typeRegistryT) NewByTypeID(id TypeID) (any, error) {
+	if instance, ok := instances[id]; ok {
+		ptr := reflect.New(instance.Type())
+		ptr.Elem().Set(instance)
+		return ptr.Interface(), nil
+	}
+
 	t, ok := r[id]
+	if !ok {
+		t, ok = typeAliases[id]
+	}
 	if !ok {
 		return nil, ErrTypeIDNotRegistered{TypeID: id}
 	}
@@ -83,6 +537,39 @@ func (r typeRegistryT) NewByTypeID(id TypeID) (any, error) {
 	return reflect.New(t).Interface(), nil
 }
 
+// typeOfTypeID returns the type of values returned by NewByTypeID
+// for the exact TypeID (without constructing a value).
+func (r typeRegistryT) typeOfTypeID(id TypeID) (reflect.Type, bool) {
+	if instance, ok := instances[id]; ok {
+		return instance.Type(), true
+	}
+	if t, ok := r[id]; ok {
+		return t, true
+	}
+	t, ok := typeAliases[id]
+	return t, ok
+}
+
+// sameTarget returns true if all the TypeIDs define the same type
+// (for example, a TypeID and its alias), so NewByTypeID returns
+// equivalent values for them.
+func (r typeRegistryT) sameTarget(ids []TypeID) bool {
+	// targets is a set of distinct results of the TypeIDs: the types,
+	// or the TypeIDs of the instances (each instance is distinct).
+	targets := map[any]struct{}{}
+	for _, id := range ids {
+		switch t, ok := r[id]; {
+		case instances[id].IsValid():
+			targets[id] = struct{}{}
+		case ok:
+			targets[t] = struct{}{}
+		default:
+			targets[typeAliases[id]] = struct{}{}
+		}
+	}
+	return len(targets) == 1
+}
+
 func typeOf(sample any) reflect.Type {
 	t := reflect.ValueOf(sample).Type()
 	for t.Kind() == reflect.Pointer {
@@ -92,14 +579,27 @@ func typeOf(sample any) reflect.Type {
 	return t
 }
 
+// isExportedType returns true if the type could be referenced from
+// another package (it is a named exported type, or a predeclared type).
+func isExportedType(t reflect.Type) bool {
+	if t.Name() == "" {
+		return false
+	}
+	return t.PkgPath() == "" || token.IsExported(t.Name())
+}
+
 func typeToID(t reflect.Type) TypeID {
+	if fullTypeIDs() && t.PkgPath() != "" {
+		return TypeID(t.PkgPath() + "." + typeName(t))
+	}
+
 	myPkgPath := reflect.TypeOf(typeRegistry).PkgPath()
 	if t.PkgPath() == myPkgPath {
 		// If the type is define in this package, then just use its name as the typeID.
 		//
 		// So that we will tag a type for example as "ActualFirmware"
 		// instead of "github.com/immune-gmbh/attestation-sdk/pkg/analysis.ActualFirmware",
-		return TypeID(t.Name())
+		return TypeID(typeName(t))
 	}
 
 	pkgPkgPath := filepath.Dir(myPkgPath)
@@ -110,9 +610,9 @@ func typeToID(t reflect.Type) TypeID {
 		// So that we will tag a type for example as "./analyzers/reproducepcr.ExpectedPCR0"
 		// instead of "github.com/immune-gmbh/attestation-sdk/pkg/analyzers/reproducepcr.ExpectedPCR0".
 		relativePath := t.PkgPath()[len(pkgPkgPath)+1:]
-		return TypeID("./" + relativePath + "." + t.Name())
+		return TypeID("./" + relativePath + "." + typeName(t))
 	}
 
 	// Otherwise use the full path
-	return TypeID(t.PkgPath() + "." + t.Name())
+	return TypeID(t.PkgPath() + "." + typeName(t))
 }
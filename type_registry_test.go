@@ -0,0 +1,652 @@
+// Copyright 2025 Dmitrii Okunev.
+// Copyright 2023 Meta Platforms, Inc. and affiliates.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"maps"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// isolateTypeRegistry makes the registrations done by the test
+// to be reverted after it.
+func isolateTypeRegistry(t *testing.T) {
+	t.Cleanup(restoreFunc(typeRegistry))
+	t.Cleanup(restoreFunc(typeIDs))
+	t.Cleanup(restoreFunc(typeAliases))
+	t.Cleanup(restoreFunc(defaultImpls))
+	t.Cleanup(restoreFunc(defaultSliceItemImpls))
+	t.Cleanup(restoreFunc(stringifiedNumberTypes))
+	t.Cleanup(restoreFunc(instances))
+	t.Cleanup(restoreFunc(instanceIDs))
+	t.Cleanup(restoreFunc(interfaceStorages))
+	t.Cleanup(func() {
+		needsWalkCache.Clear()
+		soleImplementationCache.Clear()
+	})
+}
+
+// restoreFunc returns a function, which restores the current content of the map.
+func restoreFunc[K comparable, V any, M ~map[K]V](m M) func() {
+	saved := maps.Clone(m)
+	return func() {
+		clear(m)
+		maps.Copy(m, saved)
+	}
+}
+
+type unregisteredPolyTyper struct{}
+
+func (unregisteredPolyTyper) PolyType() string {
+	return "myPolyType"
+}
+
+func TestWithPolyTypeFallback(t *testing.T) {
+	obj := []any{unregisteredPolyTyper{}}
+	_, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry(), WithPolyTypeFallback(true))
+	require.NoError(t, err)
+	require.Equal(t, `[{"myPolyType":{}}]`, string(b))
+	require.False(t, IsRegisteredType(unregisteredPolyTyper{}))
+}
+
+type checkRegistrationRegistered struct{}
+type checkRegistrationUnregistered struct{}
+
+func TestCheckRegistration(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(checkRegistrationRegistered{})
+
+	require.NoError(t, CheckRegistration(map[string]any{
+		"a": checkRegistrationRegistered{},
+		"b": nil,
+	}))
+
+	err := CheckRegistration(struct {
+		A any
+		B []any
+		C map[string]any
+	}{
+		A: checkRegistrationRegistered{},
+		B: []any{checkRegistrationRegistered{}, checkRegistrationUnregistered{}},
+		C: map[string]any{"x": &checkRegistrationUnregistered{}},
+	})
+	require.Error(t, err)
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+	require.Contains(t, err.Error(), "$.B[1]: ")
+	require.Contains(t, err.Error(), `$.C["x"]: `)
+	require.False(t, IsRegisteredType(checkRegistrationUnregistered{}))
+}
+
+type aliasedType struct {
+	Calculator Calculator
+}
+
+func TestTypeAliasDecode(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(aliasedType{})
+	RegisterType(CalculatorLinear{})
+	RegisterTypeAlias("oldAliasedType", aliasedType{})
+	RegisterTypeAlias("./legacy.CalculatorLinear", CalculatorLinear{})
+
+	b, err := MarshalWithTypeIDs(map[string]any{"a": aliasedType{Calculator: CalculatorLinear{K: 1}}}, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"a":{"aliasedType":{"Calculator":{"CalculatorLinear":{"K":1}}}}}`, string(b))
+
+	var cpy map[string]any
+	err = UnmarshalWithTypeIDs([]byte(`{"a":{"oldAliasedType":{"Calculator":{"./legacy.CalculatorLinear":{"K":2}}}}}`), &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"a": aliasedType{Calculator: CalculatorLinear{K: 2}}}, cpy)
+
+	_, err = TypeRegistry().NewByTypeID("unknownAlias")
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+}
+
+type taggedTypeID struct {
+	_ struct{} `polyjson:"id=myTaggedType"`
+	A int
+}
+
+type customTypeID struct {
+	B int
+}
+
+func TestRegisterTypeWithDeclaredTypeID(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(taggedTypeID{})
+	RegisterTypeAs("myCustomType", customTypeID{})
+
+	typeID, err := TypeRegistry().TypeIDOf(&taggedTypeID{})
+	require.NoError(t, err)
+	require.Equal(t, TypeID("myTaggedType"), typeID)
+
+	b, err := MarshalWithTypeIDs(map[string]any{
+		"a": taggedTypeID{A: 1},
+		"b": customTypeID{B: 2},
+	}, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"a":{"myTaggedType":{"A":1}},"b":{"myCustomType":{"B":2}}}`, string(b))
+
+	var cpy map[string]any
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"a": taggedTypeID{A: 1},
+		"b": customTypeID{B: 2},
+	}, cpy)
+}
+
+type genericBox[T any] struct {
+	V T
+}
+
+func TestRegisterTypesGenericInstances(t *testing.T) {
+	RegisterTypes(genericBox[float64]{}, genericBox[int]{}, &genericBox[Struct3]{})
+
+	for sample, expectedTypeID := range map[any]TypeID{
+		genericBox[float64]{}: "genericBox[float64]",
+		genericBox[int]{}:     "genericBox[int]",
+		genericBox[Struct3]{}: "genericBox[github.com/xaionaro-go/polyjson.Struct3]",
+	} {
+		typeID, err := TypeRegistry().TypeIDOf(sample)
+		require.NoError(t, err)
+		require.Equal(t, expectedTypeID, typeID)
+	}
+
+	testObj := map[string]any{
+		"f": genericBox[float64]{V: 1.5},
+		"i": genericBox[int]{V: 2},
+	}
+	b, err := MarshalWithTypeIDs(testObj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"f":{"genericBox[float64]":{"V":1.5}},"i":{"genericBox[int]":{"V":2}}}`, string(b))
+
+	var cpy map[string]any
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, testObj, cpy)
+}
+
+type genericPair[K, V any] struct {
+	K K
+	V V
+}
+
+func TestSetGenericTypeIDFormat(t *testing.T) {
+	isolateTypeRegistry(t)
+	oldValue := genericTypeIDFormat()
+	t.Cleanup(func() { SetGenericTypeIDFormat(oldValue) })
+	SetGenericTypeIDFormat(TypeArgsFormat{Open: "_", Separator: "_", Close: "_"})
+
+	RegisterTypes(genericBox[bool]{}, genericPair[string, genericBox[uint8]]{})
+	testObj := map[string]any{
+		"b": genericBox[bool]{V: true},
+		"p": genericPair[string, genericBox[uint8]]{K: "k", V: genericBox[uint8]{V: 1}},
+	}
+	b, err := MarshalWithTypeIDs(testObj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"b":{"genericBox_bool_":{"V":true}},"p":{"genericPair_string_github.com/xaionaro-go/polyjson.genericBox_uint8__":{"K":"k","V":{"V":1}}}}`, string(b))
+
+	var cpy map[string]any
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, testObj, cpy)
+}
+
+func TestSplitTypeWrapper(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(CalculatorLinear{})
+	RegisterTypeAlias("./legacy.CalculatorLinear", CalculatorLinear{})
+
+	typeID, content, ok := SplitTypeWrapper([]byte(`{"CalculatorLinear":{"K":1}}`))
+	require.True(t, ok)
+	require.Equal(t, TypeID("CalculatorLinear"), typeID)
+	require.Equal(t, `{"K":1}`, string(content))
+
+	typeID, content, ok = SplitTypeWrapper([]byte(` {"./legacy.CalculatorLinear" : [1, 2]} `))
+	require.True(t, ok)
+	require.Equal(t, TypeID("./legacy.CalculatorLinear"), typeID)
+	require.Equal(t, `[1, 2]`, string(content))
+
+	for _, doc := range []string{
+		`{"unknownType":{"K":1}}`,
+		`{"CalculatorLinear":{"K":1},"B":2}`,
+		`{}`,
+		`["CalculatorLinear"]`,
+		`"CalculatorLinear"`,
+	} {
+		_, _, ok = SplitTypeWrapper([]byte(doc))
+		require.False(t, ok, doc)
+	}
+}
+
+type unexportedAutoType struct {
+	A int
+}
+
+type ExportedAutoType struct {
+	A int
+}
+
+func TestAutoRegisterUnexportedType(t *testing.T) {
+	isolateTypeRegistry(t)
+	AutoRegisterTypes = true
+	defer func() { AutoRegisterTypes = false }()
+
+	b, err := MarshalWithTypeIDs(map[string]any{"a": &ExportedAutoType{A: 1}}, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"a":{"ExportedAutoType":{"A":1}}}`, string(b))
+
+	for _, v := range []any{unexportedAutoType{A: 1}, struct{ A int }{A: 1}} {
+		_, err = MarshalWithTypeIDs(map[string]any{"a": v}, TypeRegistry())
+		require.ErrorAs(t, err, &ErrUnexportedType{}, "%T", v)
+	}
+	require.False(t, IsRegisteredType(unexportedAutoType{}))
+}
+
+type Dict map[string]any
+
+func TestRegisteredMapTypes(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(Dict{})
+	RegisterTypeAs("stringMap", map[string]string{})
+	RegisterType(CalculatorLinear{})
+
+	obj := map[string]any{
+		"dict":   Dict{"calc": CalculatorLinear{K: 1}, "nested": Dict{}, "nil": nil},
+		"plain":  map[string]string{"a": "b"},
+		"struct": aliasedType{Calculator: CalculatorLinear{K: 2}},
+	}
+	RegisterType(aliasedType{})
+
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"dict":{"Dict":{"calc":{"CalculatorLinear":{"K":1}},"nested":{"Dict":{}},"nil":null}},"plain":{"stringMap":{"a":"b"}},"struct":{"aliasedType":{"Calculator":{"CalculatorLinear":{"K":2}}}}}`, string(b))
+
+	var cpy map[string]any
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+}
+
+type prefixedType struct {
+	Calculator Calculator
+}
+
+func TestRegisterTypeWithPrefix(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterTypeWithPrefix("myapp/", prefixedType{})
+	RegisterTypeWithPrefix("myapp/", taggedTypeID{})
+	RegisterType(CalculatorLinear{})
+
+	typeID, err := TypeRegistry().TypeIDOf(prefixedType{})
+	require.NoError(t, err)
+	require.Equal(t, TypeID("myapp/prefixedType"), typeID)
+
+	typeID, err = TypeRegistry().TypeIDOf(taggedTypeID{})
+	require.NoError(t, err)
+	require.Equal(t, TypeID("myTaggedType"), typeID)
+
+	obj := map[string]any{"a": prefixedType{Calculator: CalculatorLinear{K: 1}}}
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"a":{"myapp/prefixedType":{"Calculator":{"CalculatorLinear":{"K":1}}}}}`, string(b))
+
+	var cpy map[string]any
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+}
+
+type calculatorFunc struct {
+	Name string
+	fn   func(float64) float64
+}
+
+func (c *calculatorFunc) Calculate(x float64) float64 {
+	return c.fn(x)
+}
+
+func TestRegisterInstance(t *testing.T) {
+	isolateTypeRegistry(t)
+	double := &calculatorFunc{Name: "double", fn: func(x float64) float64 { return x * 2 }}
+	square := &calculatorFunc{Name: "square", fn: func(x float64) float64 { return x * x }}
+	RegisterInstance("double", double)
+	RegisterInstance("square", square)
+
+	obj := []Strategy{{Name: "a", Calculator: double}, {Name: "b", Calculator: square}}
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `[{"Calculator":{"double":{"Name":"double"}},"Name":"a"},{"Calculator":{"square":{"Name":"square"}},"Name":"b"}]`, string(b))
+
+	var cpy []Strategy
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Len(t, cpy, 2)
+	require.Equal(t, float64(6), cpy[0].Calculator.Calculate(3))
+	require.Equal(t, float64(9), cpy[1].Calculator.Calculate(3))
+
+	// the decoded values are copies, the registered instances are intact
+	require.NotSame(t, double, cpy[0].Calculator)
+	err = UnmarshalWithTypeIDs([]byte(`[{"Calculator":{"double":{"Name":"renamed"}}}]`), &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, "renamed", cpy[0].Calculator.(*calculatorFunc).Name)
+	require.Equal(t, "double", double.Name)
+
+	// a decoded copy cannot be told apart from the other instance of the type
+	_, err = MarshalWithTypeIDs(cpy, TypeRegistry())
+	var errAmbiguous ErrAmbiguousInstance
+	require.ErrorAs(t, err, &errAmbiguous)
+	require.Equal(t, []TypeID{"double", "square"}, errAmbiguous.Candidates)
+}
+
+type soleIface interface {
+	isSole()
+}
+
+type soleImpl struct {
+	A int
+}
+
+func (*soleImpl) isSole() {}
+
+func TestWithMinimalWrapping(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(soleImpl{})
+	RegisterType(CalculatorLinear{})
+	RegisterType(CalculatorConst{})
+
+	type doc struct {
+		Sole       soleIface
+		Calculator Calculator
+	}
+	obj := doc{Sole: &soleImpl{A: 1}, Calculator: CalculatorLinear{K: 2}}
+
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry(), WithMinimalWrapping(true))
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":{"CalculatorLinear":{"K":2}},"Sole":{"A":1}}`, string(b))
+
+	var cpy doc
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry(), WithMinimalWrapping(true))
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+
+	// wrapped values are still accepted
+	b, err = MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":{"CalculatorLinear":{"K":2}},"Sole":{"soleImpl":{"A":1}}}`, string(b))
+	cpy = doc{}
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry(), WithMinimalWrapping(true))
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+
+	// without the option the unwrapped value is not accepted
+	err = UnmarshalWithTypeIDs([]byte(`{"Sole":{"A":1}}`), &cpy, TypeRegistry())
+	require.Error(t, err)
+
+	// the implementations are inferred only from the type registry
+	b, err = MarshalWithTypeIDs(obj, typeIDHandlerT{}, WithMinimalWrapping(true))
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}},"Sole":{"*github.com/xaionaro-go/polyjson.soleImpl":{"A":1}}}`, string(b))
+
+	// the sole implementation is still subject to "oneof"
+	type restricted struct {
+		Sole soleIface `polyjson:"oneof=CalculatorLinear"`
+	}
+	var restrictedCpy restricted
+	err = UnmarshalWithTypeIDs([]byte(`{"Sole":{"A":1}}`), &restrictedCpy, TypeRegistry(), WithMinimalWrapping(true))
+	var errNotAllowed ErrTypeIDNotAllowed
+	require.ErrorAs(t, err, &errNotAllowed)
+	require.Equal(t, TypeID("soleImpl"), errNotAllowed.TypeID)
+
+	// a new implementation makes the interface ambiguous
+	RegisterType(anotherSoleImpl{})
+	b, err = MarshalWithTypeIDs(obj, TypeRegistry(), WithMinimalWrapping(true))
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":{"CalculatorLinear":{"K":2}},"Sole":{"soleImpl":{"A":1}}}`, string(b))
+
+	t.Run("empty_interface", func(t *testing.T) {
+		isolateTypeRegistry(t)
+		clear(typeRegistry)
+		clear(typeIDs)
+		RegisterType(CalculatorLinear{})
+
+		// any value could be stored in "any", so it is always wrapped
+		type anyDoc struct {
+			X any
+		}
+		b, err := MarshalWithTypeIDs(anyDoc{X: CalculatorLinear{K: 1}}, TypeRegistry(), WithMinimalWrapping(true))
+		require.NoError(t, err)
+		require.Equal(t, `{"X":{"CalculatorLinear":{"K":1}}}`, string(b))
+		b, err = MarshalWithTypeIDs(map[string]any{"X": CalculatorLinear{K: 1}}, TypeRegistry(), WithMinimalWrapping(true))
+		require.NoError(t, err)
+		require.Equal(t, `{"X":{"CalculatorLinear":{"K":1}}}`, string(b))
+
+		var cpy anyDoc
+		err = UnmarshalWithTypeIDs([]byte(`{"X":"hello"}`), &cpy, TypeRegistry(), WithMinimalWrapping(true))
+		if err == nil {
+			require.Equal(t, "hello", cpy.X)
+		}
+		require.NotEqual(t, CalculatorLinear{}, cpy.X)
+	})
+}
+
+type anotherSoleImpl struct{}
+
+func (anotherSoleImpl) isSole() {}
+
+type fullTypeIDsSample struct {
+	A int
+}
+
+func TestSetFullTypeIDs(t *testing.T) {
+	isolateTypeRegistry(t)
+	oldValue := fullTypeIDs()
+	t.Cleanup(func() { SetFullTypeIDs(oldValue) })
+
+	SetFullTypeIDs(false)
+	require.Equal(t, TypeID("fullTypeIDsSample"), typeToID(reflect.TypeOf(fullTypeIDsSample{})))
+	require.Equal(t, TypeID("math/big.Int"), typeToID(reflect.TypeOf(big.Int{})))
+	require.Equal(t, TypeID(".int"), typeToID(reflect.TypeOf(0)))
+
+	SetFullTypeIDs(true)
+	require.Equal(t, TypeID("github.com/xaionaro-go/polyjson.fullTypeIDsSample"), typeToID(reflect.TypeOf(fullTypeIDsSample{})))
+	require.Equal(t, TypeID("math/big.Int"), typeToID(reflect.TypeOf(big.Int{})))
+	require.Equal(t, TypeID(".int"), typeToID(reflect.TypeOf(0)))
+
+	RegisterType(fullTypeIDsSample{})
+	b, err := MarshalWithTypeIDs(map[string]any{"a": fullTypeIDsSample{A: 1}}, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"a":{"github.com/xaionaro-go/polyjson.fullTypeIDsSample":{"A":1}}}`, string(b))
+}
+
+type implsIface interface {
+	isImpls()
+}
+
+type implsByValue struct{}
+
+func (implsByValue) isImpls() {}
+
+type implsByPointer struct{}
+
+func (*implsByPointer) isImpls() {}
+
+type implsNone struct{}
+
+func TestImplementationsOf(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(implsByValue{})
+	RegisterType(&implsByPointer{})
+	RegisterType(implsNone{})
+	RegisterTypeAlias("oldImplsByValue", implsByValue{})
+
+	require.Equal(t, []TypeID{"implsByPointer", "implsByValue"}, ImplementationsOf((*implsIface)(nil)))
+	require.Panics(t, func() { ImplementationsOf(implsByValue{}) })
+}
+
+func (b genericBox[T]) Calculate(x float64) float64 {
+	if calculator, ok := any(b.V).(Calculator); ok {
+		return calculator.Calculate(x)
+	}
+	return x
+}
+
+func TestGenericInstanceWithInterfaceTypeArgument(t *testing.T) {
+	RegisterTypes(genericBox[Calculator]{}, CalculatorLinear{}, CalculatorConst{})
+
+	obj := []Calculator{
+		genericBox[Calculator]{V: CalculatorLinear{K: 2}},
+		genericBox[Calculator]{V: genericBox[Calculator]{V: &CalculatorConst{C: 3}}},
+		genericBox[Calculator]{},
+	}
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `[`+
+		`{"genericBox[github.com/xaionaro-go/polyjson.Calculator]":{"V":{"CalculatorLinear":{"K":2}}}},`+
+		`{"genericBox[github.com/xaionaro-go/polyjson.Calculator]":{"V":{"genericBox[github.com/xaionaro-go/polyjson.Calculator]":{"V":{"CalculatorConst":{"C":3}}}}}},`+
+		`{"genericBox[github.com/xaionaro-go/polyjson.Calculator]":{"V":null}}`+
+		`]`, string(b))
+
+	var cpy []Calculator
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, TypeRegistry()))
+	require.Equal(t, obj, cpy)
+	require.Equal(t, float64(3), cpy[1].Calculate(1))
+}
+
+type sharedFormsType struct {
+	A int
+}
+
+func (sharedFormsType) Calculate(x float64) float64 {
+	return x
+}
+
+func TestValueAndPointerFormsShareTypeID(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(&sharedFormsType{})
+
+	for _, sample := range []any{sharedFormsType{}, &sharedFormsType{}, (*sharedFormsType)(nil)} {
+		typeID, err := TypeRegistry().TypeIDOf(sample)
+		require.NoError(t, err)
+		require.Equal(t, TypeID("sharedFormsType"), typeID, "%T", sample)
+	}
+	sample, err := TypeRegistry().NewByTypeID("sharedFormsType")
+	require.NoError(t, err)
+	require.Equal(t, &sharedFormsType{}, sample)
+
+	b, err := MarshalWithTypeIDs([]Calculator{sharedFormsType{A: 1}, &sharedFormsType{A: 2}}, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `[{"sharedFormsType":{"A":1}},{"sharedFormsType":{"A":2}}]`, string(b))
+
+	// the value receivers allow to store the value itself
+	var cpy []Calculator
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, TypeRegistry()))
+	require.Equal(t, []Calculator{sharedFormsType{A: 1}, sharedFormsType{A: 2}}, cpy)
+}
+
+type storedByPointerType struct {
+	A int
+}
+
+func (storedByPointerType) Calculate(x float64) float64 {
+	return x
+}
+
+type storedByValueType struct {
+	A int
+}
+
+func (*storedByValueType) Calculate(x float64) float64 {
+	return x
+}
+
+func TestRegisterInterfaceStorage(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(storedByPointerType{})
+	RegisterType(storedByValueType{})
+
+	t.Run("auto", func(t *testing.T) {
+		var cpy []Calculator
+		require.NoError(t, UnmarshalWithTypeIDs([]byte(`[{"storedByPointerType":{"A":1}},{"storedByValueType":{"A":2}}]`), &cpy, TypeRegistry()))
+		require.Equal(t, []Calculator{storedByPointerType{A: 1}, &storedByValueType{A: 2}}, cpy)
+	})
+
+	t.Run("by_pointer", func(t *testing.T) {
+		isolateTypeRegistry(t)
+		RegisterInterfaceStorage(storedByPointerType{}, InterfaceStorageByPointer)
+
+		var cpy struct {
+			Calculator Calculator
+			Any        any
+		}
+		require.NoError(t, UnmarshalWithTypeIDs([]byte(`{"Calculator":{"storedByPointerType":{"A":1}},"Any":{"storedByPointerType":{"A":2}}}`), &cpy, TypeRegistry()))
+		require.Equal(t, &storedByPointerType{A: 1}, cpy.Calculator)
+		require.Equal(t, &storedByPointerType{A: 2}, cpy.Any)
+	})
+
+	t.Run("by_value", func(t *testing.T) {
+		isolateTypeRegistry(t)
+		RegisterInterfaceStorage(&storedByValueType{}, InterfaceStorageByValue)
+
+		var anyValue any
+		require.NoError(t, UnmarshalWithTypeIDs([]byte(`{"storedByValueType":{"A":1}}`), &anyValue, TypeRegistry()))
+		require.Equal(t, storedByValueType{A: 1}, anyValue)
+
+		// only the pointer implements the interface
+		var calculator Calculator
+		err := UnmarshalWithTypeIDs([]byte(`{"storedByValueType":{"A":1}}`), &calculator, TypeRegistry())
+		require.ErrorContains(t, err, "requested to be stored by value")
+	})
+}
+
+type caseInsensitiveType struct {
+	A int
+}
+
+type caseInsensitiveOther struct {
+	A int
+}
+
+func TestWithCaseInsensitiveTypeIDs(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterTypeAs("./pkg.CaseInsensitive", caseInsensitiveType{})
+	RegisterTypeAlias("./PKG.caseinsensitive", caseInsensitiveType{})
+	RegisterTypeAs("./pkg.Dup", caseInsensitiveType{})
+	RegisterTypeAs("./pkg.DUP", caseInsensitiveOther{})
+
+	var dst any
+	err := UnmarshalWithTypeIDs([]byte(`{"./Pkg.CaseInsensitive":{"A":1}}`), &dst, TypeRegistry())
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{}, "case-sensitive by default")
+
+	opt := WithCaseInsensitiveTypeIDs(true)
+	require.NoError(t, UnmarshalWithTypeIDs([]byte(`{"./Pkg.CaseInsensitive":{"A":1}}`), &dst, TypeRegistry(), opt))
+	require.Equal(t, caseInsensitiveType{A: 1}, dst)
+
+	// the exact case takes precedence
+	require.NoError(t, UnmarshalWithTypeIDs([]byte(`{"./pkg.DUP":{}}`), &dst, TypeRegistry(), opt))
+	require.Equal(t, caseInsensitiveOther{}, dst)
+
+	err = UnmarshalWithTypeIDs([]byte(`{"./pkg.dup":{}}`), &dst, TypeRegistry(), opt)
+	var errAmbiguous ErrAmbiguousTypeID
+	require.ErrorAs(t, err, &errAmbiguous)
+	require.Equal(t, []TypeID{"./pkg.DUP", "./pkg.Dup"}, errAmbiguous.Candidates)
+
+	err = UnmarshalWithTypeIDs([]byte(`{"./pkg.Missing":{}}`), &dst, TypeRegistry(), opt)
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+}
@@ -0,0 +1,255 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	numberType     = reflect.TypeOf(json.Number(""))
+
+	anyType          = reflect.TypeOf((*any)(nil)).Elem()
+	mapStringAnyType = reflect.TypeOf(map[string]any(nil))
+)
+
+// needsWalkCache is a cache of reflect.Type to the result of needsWalk.
+var needsWalkCache sync.Map
+
+// needsWalk returns true if a value of the given type may contain
+// something (reachable through exported fields, pointers, slices, arrays or maps)
+// which requires our own reflective walk instead of the standard "encoding/json" package:
+//   - an interface (requires TypeIDs);
+//   - a channel or a function (we need to report the path to the unsupported value);
+//   - a type registered through RegisterStringifiedNumberType.
+//
+// If it returns false then the value could be safely processed by
+// the standard "encoding/json" package.
+func needsWalk(t reflect.Type) bool {
+	if result, ok := needsWalkCache.Load(t); ok {
+		return result.(bool)
+	}
+
+	result := needsWalkRecursive(t, map[reflect.Type]struct{}{})
+	needsWalkCache.Store(t, result)
+	return result
+}
+
+func needsWalkRecursive(t reflect.Type, visited map[reflect.Type]struct{}) bool {
+	if _, ok := visited[t]; ok {
+		// recursive type, the result will be decided by the other branches
+		return false
+	}
+	visited[t] = struct{}{}
+
+	if _, ok := stringifiedNumberTypes[t]; ok {
+		return true
+	}
+	if isMarshalerLeaf(t) || isUnmarshalerLeaf(t) {
+		// the value handles itself
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Interface, reflect.Chan, reflect.Func:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return needsWalkRecursive(t.Elem(), visited)
+	case reflect.Map:
+		return needsWalkRecursive(t.Key(), visited) || needsWalkRecursive(t.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			fT := t.Field(i)
+			if fT.PkgPath != "" {
+				// unexported
+				continue
+			}
+			if _, ok := parseFieldTag(fT); !ok {
+				// requested to skip
+				continue
+			}
+			if needsWalkRecursive(fT.Type, visited) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// keyOrderCacheKey is a key of keyOrderCache.
+type keyOrderCacheKey struct {
+	Type           reflect.Type
+	StdlibKeyOrder bool
+}
+
+// keyOrderCache is a cache of keyOrderCacheKey to the result of needsKeyOrdering.
+var keyOrderCache sync.Map
+
+// needsKeyOrdering returns true if a value of the given type may contain
+// a structure (reachable through exported fields, pointers, slices, arrays
+// or maps), which keys are ordered by us differently than by the standard
+// "encoding/json" package: the keys are sorted (unless stdlibKeyOrder) and
+// tag `polyjson:"order=N"` is respected (see WithStdlibKeyOrder).
+func needsKeyOrdering(t reflect.Type, stdlibKeyOrder bool) bool {
+	key := keyOrderCacheKey{Type: t, StdlibKeyOrder: stdlibKeyOrder}
+	if result, ok := keyOrderCache.Load(key); ok {
+		return result.(bool)
+	}
+
+	result := needsKeyOrderingRecursive(t, stdlibKeyOrder, map[reflect.Type]struct{}{})
+	keyOrderCache.Store(key, result)
+	return result
+}
+
+func needsKeyOrderingRecursive(t reflect.Type, stdlibKeyOrder bool, visited map[reflect.Type]struct{}) bool {
+	if _, ok := visited[t]; ok {
+		return false
+	}
+	visited[t] = struct{}{}
+
+	if isMarshalerLeaf(t) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return needsKeyOrderingRecursive(t.Elem(), stdlibKeyOrder, visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			fT := t.Field(i)
+			if fT.PkgPath != "" {
+				continue
+			}
+			if _, ok := parseFieldTag(fT); !ok {
+				continue
+			}
+			if !stdlibKeyOrder {
+				// the keys are sorted
+				return true
+			}
+			if _, ok := parsePolyjsonTag(fT)["order"]; ok {
+				return true
+			}
+			if needsKeyOrderingRecursive(fT.Type, stdlibKeyOrder, visited) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isComposite returns true if a value of the given type is represented
+// as a JSON object or array.
+func isComposite(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Array:
+		return true
+	case reflect.Slice:
+		// []byte is represented as a base64 string
+		return t.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// isObjectKind returns true if a value of the given type (or of the type
+// it points to) is represented as a JSON object.
+func isObjectKind(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// isNumeric returns true if the type is an integer or a floating point number.
+func isNumeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isEmptyValue returns true if the value is considered empty
+// by option "omitempty" (the same rules as in "encoding/json").
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// isDeepEmptyValue returns true if the value is considered empty
+// by option "omitemptydeep": it is empty by "omitempty" rules, or it is
+// an interface holding the zero value of its concrete type (directly
+// or through pointers).
+func isDeepEmptyValue(v reflect.Value) bool {
+	if isEmptyValue(v) {
+		return true
+	}
+	if v.Kind() != reflect.Interface {
+		return false
+	}
+	v = v.Elem()
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.IsZero()
+}
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isMarshalerLeaf returns true if values of the (non-pointer, non-interface)
+// type marshal themselves (for example, big.Int or time.Time), so the walk
+// should not descend into them.
+func isMarshalerLeaf(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer || t.Kind() == reflect.Interface {
+		return false
+	}
+	ptrType := reflect.PointerTo(t)
+	return ptrType.Implements(jsonMarshalerType) || ptrType.Implements(textMarshalerType)
+}
+
+// isUnmarshalerLeaf returns true if values of the (non-pointer, non-interface)
+// type unmarshal themselves (for example, big.Int or time.Time), so the walk
+// should not descend into them.
+func isUnmarshalerLeaf(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer || t.Kind() == reflect.Interface {
+		return false
+	}
+	ptrType := reflect.PointerTo(t)
+	return ptrType.Implements(jsonUnmarshalerType) || ptrType.Implements(textUnmarshalerType)
+}
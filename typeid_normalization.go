@@ -0,0 +1,151 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// TypeIDLister is an optional interface of a NewByTypeIDer, which allows
+// to enumerate the known TypeIDs (see WithTypeIDNormalization and
+// WithCaseInsensitiveTypeIDs).
+type TypeIDLister interface {
+	// TypeIDs returns all the TypeIDs known to the NewByTypeIDer.
+	TypeIDs() []TypeID
+}
+
+var _ TypeIDLister = typeRegistryT{}
+
+// TypeIDs returns all the registered TypeIDs (including aliases,
+// see RegisterTypeAlias) in the sorted order.
+func (r typeRegistryT) TypeIDs() []TypeID {
+	result := make([]TypeID, 0, len(r)+len(typeAliases))
+	for typeID := range r {
+		result = append(result, typeID)
+	}
+	for typeID := range typeAliases {
+		if _, ok := r[typeID]; !ok {
+			result = append(result, typeID)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// unqualifiedTypeID returns the TypeID without the package path,
+// for example "*github.com/xaionaro-go/polyjson.Struct[./a.B]" -> "*Struct[./a.B]".
+func unqualifiedTypeID(typeID TypeID) TypeID {
+	s := string(typeID)
+	stars := s[:len(s)-len(strings.TrimLeft(s, "*"))]
+	s = s[len(stars):]
+
+	name, args, hasArgs := strings.Cut(s, "[")
+	if idx := strings.LastIndexAny(name, "./"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if hasArgs {
+		name += "[" + args
+	}
+	return TypeID(stars + name)
+}
+
+// newByNormalizedTypeID returns a pointer to a new value of the type defined by
+// the TypeID, tolerating qualified and unqualified forms of the TypeID
+// if requested (see WithTypeIDNormalization).
+func (u *unmarshaler) newByNormalizedTypeID(typeID TypeID) (any, error) {
+	typedValuePtr, err := u.newByTypeIDer.NewByTypeID(typeID)
+	if err == nil {
+		return typedValuePtr, nil
+	}
+	if u.CaseInsensitiveTypeIDs {
+		if typedValuePtr, ok, foldErr := u.newByTypeIDFold(typeID); ok || foldErr != nil {
+			return typedValuePtr, foldErr
+		}
+	}
+	if !u.TypeIDNormalization {
+		return typedValuePtr, err
+	}
+
+	unqualified := unqualifiedTypeID(typeID)
+	if unqualified != typeID {
+		if typedValuePtr, unqualifiedErr := u.newByTypeIDer.NewByTypeID(unqualified); unqualifiedErr == nil {
+			return typedValuePtr, nil
+		}
+	}
+
+	lister, ok := u.newByTypeIDer.(TypeIDLister)
+	if !ok {
+		return nil, err
+	}
+	var candidates []TypeID
+	for _, candidate := range lister.TypeIDs() {
+		if candidate != typeID && unqualifiedTypeID(candidate) == unqualified {
+			candidates = append(candidates, candidate)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, err
+	case 1:
+		return u.newByTypeIDer.NewByTypeID(candidates[0])
+	default:
+		return nil, errors.Join(err, ErrAmbiguousTypeID{TypeID: typeID, Candidates: candidates})
+	}
+}
+
+type optionCaseInsensitiveTypeIDs bool
+
+func (opt optionCaseInsensitiveTypeIDs) apply(cfg *config) {
+	cfg.CaseInsensitiveTypeIDs = bool(opt)
+}
+
+// WithCaseInsensitiveTypeIDs makes UnmarshalWithTypeIDs to match an unknown
+// TypeID against the known ones (if the NewByTypeIDer implements TypeIDLister,
+// for example the type registry) case-insensitively (for example "./PKG.foo"
+// matches "./pkg.Foo"), if a TypeID of the exact case is unknown. If the TypeID
+// matches multiple types, then ErrAmbiguousTypeID is returned.
+//
+// It is intended to tolerate producers inconsistent about casing
+// (for example, during a migration).
+func WithCaseInsensitiveTypeIDs(enable bool) Option {
+	return optionCaseInsensitiveTypeIDs(enable)
+}
+
+// newByTypeIDFold is the same as NewByTypeID of the NewByTypeIDer, but matches
+// the TypeID case-insensitively (see WithCaseInsensitiveTypeIDs). It returns
+// false if there is no matching TypeID.
+func (u *unmarshaler) newByTypeIDFold(typeID TypeID) (any, bool, error) {
+	lister, ok := u.newByTypeIDer.(TypeIDLister)
+	if !ok {
+		return nil, false, nil
+	}
+	var candidates []TypeID
+	for _, candidate := range lister.TypeIDs() {
+		if candidate != typeID && strings.EqualFold(string(candidate), string(typeID)) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, false, nil
+	}
+	if len(candidates) > 1 {
+		registry, ok := u.newByTypeIDer.(typeRegistryT)
+		if !ok || !registry.sameTarget(candidates) {
+			return nil, true, ErrAmbiguousTypeID{TypeID: typeID, Candidates: candidates}
+		}
+	}
+	typedValuePtr, err := u.newByTypeIDer.NewByTypeID(candidates[0])
+	return typedValuePtr, true, err
+}
@@ -0,0 +1,68 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type normalizedA struct{ A int }
+type normalizedB struct{ B int }
+type normalizedDupA struct{ DupA int }
+type normalizedDupB struct{ DupB int }
+
+func TestUnqualifiedTypeID(t *testing.T) {
+	for typeID, expected := range map[TypeID]TypeID{
+		"Foo":                                    "Foo",
+		"github.com/xaionaro-go/polyjson.Foo":    "Foo",
+		"*github.com/xaionaro-go/polyjson.Foo":   "*Foo",
+		"./indicator.MAMA[float64]":              "MAMA[float64]",
+		"./box.Box[github.com/a/b.T]":            "Box[github.com/a/b.T]",
+		"github.com/xaionaro-go/polyjson/v2.Foo": "Foo",
+	} {
+		require.Equal(t, expected, unqualifiedTypeID(typeID), typeID)
+	}
+}
+
+func TestUnmarshalWithTypeIDNormalization(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterTypeAs("normalizedA", normalizedA{})
+	RegisterTypeAs("./v2/pkg.normalizedB", normalizedB{})
+	RegisterTypeAs("./a.normalizedDup", normalizedDupA{})
+	RegisterTypeAs("./b.normalizedDup", normalizedDupB{})
+
+	doc := []byte(`{
+		"a": {"github.com/xaionaro-go/polyjson.normalizedA": {"A": 1}},
+		"b": {"normalizedB": {"B": 2}},
+		"c": {"./v1/pkg.normalizedB": {"B": 3}}
+	}`)
+
+	var cpy map[string]any
+	err := UnmarshalWithTypeIDs(doc, &cpy, TypeRegistry())
+	require.ErrorAs(t, err, &ErrTypeIDNotRegistered{})
+
+	err = UnmarshalWithTypeIDs(doc, &cpy, TypeRegistry(), WithTypeIDNormalization(true))
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"a": normalizedA{A: 1},
+		"b": normalizedB{B: 2},
+		"c": normalizedB{B: 3},
+	}, cpy)
+
+	err = UnmarshalWithTypeIDs([]byte(`{"a":{"normalizedDup":{}}}`), &cpy, TypeRegistry(), WithTypeIDNormalization(true))
+	var errAmbiguous ErrAmbiguousTypeID
+	require.ErrorAs(t, err, &errAmbiguous)
+	require.Equal(t, []TypeID{"./a.normalizedDup", "./b.normalizedDup"}, errAmbiguous.Candidates)
+}
@@ -14,18 +14,44 @@
 package polyjson
 
 import (
+	"context"
+	"encoding"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
 
+// unstringifyMapKey sets the (addressable) map key from the JSON object key,
+// using the same rules as "encoding/json" (see stringifyMapKey).
 func unstringifyMapKey(mapKey reflect.Value, s string) error {
-	if mapKey.Kind() == reflect.String {
+	if reflect.PointerTo(mapKey.Type()).Implements(textUnmarshalerType) {
+		return mapKey.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch mapKey.Kind() {
+	case reflect.String:
 		mapKey.SetString(s)
 		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || mapKey.OverflowInt(n) {
+			return fmt.Errorf("invalid map key '%s' for %s", s, mapKey.Type())
+		}
+		mapKey.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || mapKey.OverflowUint(n) {
+			return fmt.Errorf("invalid map key '%s' for %s", s, mapKey.Type())
+		}
+		mapKey.SetUint(n)
+		return nil
 	}
 
 	return fmt.Errorf("unable to unstringify map key (%T) value '%s'", mapKey.Interface(), s)
@@ -38,15 +64,114 @@ func unstringifyMapKey(mapKey reflect.Value, s string) error {
 //
 // This function is the inverse function for MarshalWithTypeIDs.
 //
+// Structure field tag options supported in addition to the JSON field name:
+//   - "string": a string, floating point, integer or boolean value is stored
+//     as JSON inside a JSON string (see also RegisterStringifiedNumberType).
+//     An unquoted value is also accepted.
+//   - "rawdecode": if the value is a JSON string containing JSON (double-encoded),
+//     then it is unquoted and parsed as JSON (ignored for string fields).
+//
+// A renamed field could be decoded from documents with its former JSON name(s)
+// by tag `polyjson:"was=OldName1,OldName2"` (the current name takes precedence).
+//
+// An interface field (or a pointer, slice, array or map of interfaces) could be
+// restricted to a set of TypeIDs by tag `polyjson:"oneof=TypeID1,TypeID2"`:
+// any other TypeID (including the TypeID of an implicitly constructed value,
+// see WithLenient and WithMinimalWrapping) causes ErrTypeIDNotAllowed.
+//
+// If an object in the document has duplicate keys, then the last one wins
+// (see also WithDisallowDuplicateKeys).
+//
+// If a destination slice has enough capacity, then its storage is reused
+// (the same as in "encoding/json"), but every item is decoded into a zero
+// value, and the items beyond the new length are cleared.
+//
+// If a structure is encoded as an interface value (`{TypeID:{...}}`),
+// but the destination is the structure itself, then the wrapper is stripped
+// (if the TypeID defines the type of the structure).
+//
+// A type-tagged null (`{TypeID:null}`, which is how a typed nil pointer
+// stored in an interface is marshaled) is decoded as a typed nil pointer.
+//
 // NOTE! This is not a drop-in replacement for standard json.Unmarshal.
 //
 //	It has incompatible behavior.
-func UnmarshalWithTypeIDs(b []byte, dst any, newByTypeIDer NewByTypeIDer) error {
+func UnmarshalWithTypeIDs(b []byte, dst any, newByTypeIDer NewByTypeIDer, opts ...Option) error {
 	// TODO: use encoding/json.Decoder instead of github.com/tidwall/gjson
-	return unmarshal(gjson.ParseBytes(b), reflect.ValueOf(dst), newByTypeIDer)
+	return newParsedDocument(b).Into(dst, newByTypeIDer, opts...)
+}
+
+// checkTrailingData returns ErrTrailingData if there is anything
+// but whitespace after the top-level value of the document
+// (see WithDisallowTrailingData).
+func checkTrailingData(doc string) error {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	var value json.RawMessage
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("unable to parse the document: %w", err)
+	}
+	offset := dec.InputOffset()
+	if len(strings.TrimSpace(doc[offset:])) != 0 {
+		return ErrTrailingData{Offset: offset}
+	}
+	return nil
+}
+
+// UnmarshalWithTypeIDsContext is the same as UnmarshalWithTypeIDs, but
+// the decoding is aborted if the context is cancelled (for example,
+// if the request which needs the document is abandoned). In this case
+// ctx.Err() is returned.
+func UnmarshalWithTypeIDsContext(ctx context.Context, b []byte, dst any, newByTypeIDer NewByTypeIDer, opts ...Option) error {
+	err := UnmarshalWithTypeIDs(b, dst, newByTypeIDer, append(opts, optionContext{Context: ctx})...)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
 
-func unmarshal(obj gjson.Result, v reflect.Value, newByTypeIDer NewByTypeIDer) error {
+// UnmarshalValue parses a document, which top level is a single type-tagged
+// value (`{TypeID:content}`), and returns the reconstructed concrete value.
+//
+// It is the same as calling UnmarshalWithTypeIDs with a pointer to a variable of type "any".
+func UnmarshalValue(b []byte, newByTypeIDer NewByTypeIDer, opts ...Option) (any, error) {
+	var result any
+	if err := UnmarshalWithTypeIDs(b, &result, newByTypeIDer, opts...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MustUnmarshalWithTypeIDs is the same as UnmarshalWithTypeIDs, but panics on an error.
+//
+// It is intended for initialization code and tests, where an error is a programmer error.
+func MustUnmarshalWithTypeIDs(b []byte, dst any, newByTypeIDer NewByTypeIDer, opts ...Option) {
+	if err := UnmarshalWithTypeIDs(b, dst, newByTypeIDer, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// unmarshaler contains the state of a single UnmarshalWithTypeIDs call.
+type unmarshaler struct {
+	newByTypeIDer NewByTypeIDer
+	config
+
+	// deadline is the time the decoding should be finished by
+	// (see WithDecodeTimeout), or zero if there is no limit.
+	deadline time.Time
+
+	// collectedErrors are the errors of the values which failed
+	// to be decoded (see WithCollectErrors).
+	collectedErrors []error
+}
+
+func (u *unmarshaler) unmarshal(obj gjson.Result, v reflect.Value, path valuePath) error {
+	return u.unmarshalRestricted(obj, v, path, nil)
+}
+
+// unmarshalRestricted is the same as unmarshal, but the interface values
+// reached through pointers, slices, arrays and maps (but not through
+// structures) are restricted to the given TypeIDs (see tag `polyjson:"oneof=..."`).
+func (u *unmarshaler) unmarshalRestricted(obj gjson.Result, v reflect.Value, path valuePath, allowedTypeIDs []string) error {
 	// How the function works:
 	//
 	// We are interested only about structures (and their fields),
@@ -60,26 +185,69 @@ func unmarshal(obj gjson.Result, v reflect.Value, newByTypeIDer NewByTypeIDer) e
 		return fmt.Errorf("expected a pointer destination, but got %T instead", v.Interface())
 	}
 
+	if u.Context != nil {
+		if err := u.Context.Err(); err != nil {
+			return err
+		}
+	}
+	if !u.deadline.IsZero() && time.Now().After(u.deadline) {
+		return ErrDecodeTimeout{Timeout: u.DecodeTimeout, Path: path.String()}
+	}
+
 	if !v.Elem().IsValid() {
 		// Some field may contain a typed nil. But we need to fill the value, so
 		// creating an empty value.
-		v.Set(reflect.New(v.Type().Elem()))
+		ptr, err := u.new(v.Type().Elem())
+		if err != nil {
+			return fmt.Errorf("unable to allocate a value at %s: %w", path, err)
+		}
+		v.Set(ptr)
+	}
+
+	if v.Type().Elem() == rawMessageType {
+		// storing the raw sub-document verbatim, to be decoded later by the user
+		v.Elem().SetBytes(append(json.RawMessage(nil), obj.Raw...))
+		return nil
+	}
+
+	if v.Type().Elem() == numberType {
+		return unmarshalNumber(obj, v.Elem())
+	}
+	if isUnmarshalerLeaf(v.Type().Elem()) {
+		return json.Unmarshal([]byte(obj.Raw), v.Interface())
 	}
 
 	switch v.Elem().Kind() {
 	case reflect.Interface:
-		// unwrapping the interface
-		return unmarshal(obj, v.Elem(), newByTypeIDer)
+		// A pointer to an interface: resolving the value through the TypeID.
+		return u.unmarshalTo(v.Elem(), v.Elem().Type(), obj, interfaceHint{AllowedTypeIDs: allowedTypeIDs}, path)
 	case reflect.Pointer:
-		return unmarshal(obj, v.Elem(), newByTypeIDer)
+		return u.unmarshalRestricted(obj, v.Elem(), path, allowedTypeIDs)
 	case reflect.Map:
 		v = v.Elem()
 
+		if obj.Type == gjson.Null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if !obj.IsObject() {
+			return fmt.Errorf("expected a JSON object for %s, but got '%s'", v.Type(), obj.Raw)
+		}
+
+		if v.Type() == mapStringAnyType {
+			// the most common shape of dynamic documents
+			return u.unmarshalMapStringAny(obj, v, path, allowedTypeIDs)
+		}
+
 		// delete all entries from the current map
 		iterator := v.MapRange()
 		for iterator.Next() {
 			v.SetMapIndex(iterator.Key(), reflect.Value{})
 		}
+		if v.IsNil() {
+			// the same as in "encoding/json": an empty object gives an empty map
+			v.Set(reflect.MakeMap(v.Type()))
+		}
 
 		// parse entries to the map
 		var err error
@@ -95,53 +263,167 @@ func unmarshal(obj gjson.Result, v reflect.Value, newByTypeIDer NewByTypeIDer) e
 			}
 
 			valueValue := reflect.New(valueType).Elem()
-			err = unmarshalTo(valueValue, valueType, value, newByTypeIDer)
+			err = u.unmarshalTo(valueValue, valueType, value, interfaceHint{AllowedTypeIDs: allowedTypeIDs}, path.Key(key.Str))
 			if err != nil {
+				if u.collect(path.Key(key.Str), err) {
+					err = nil
+					return true
+				}
 				err = fmt.Errorf("unable to unmarshal JSON '%s' of entry with key '%s': %w", value, key, err)
 				return false
 			}
 
-			if v.IsNil() {
-				// Got a nil map, initializing:
-				v.Set(reflect.MakeMap(v.Type()))
-			}
 			v.SetMapIndex(keyValue, valueValue)
 			return true
 		})
 		return err
-	case reflect.Slice, reflect.Array:
-		// conversion for slices and arrays is not supported, yet
-		return json.Unmarshal([]byte(obj.Raw), v.Interface())
+	case reflect.Slice:
+		if !needsWalk(v.Type().Elem()) {
+			// nothing polymorphic inside, the standard unmarshaler is good enough
+			return json.Unmarshal([]byte(obj.Raw), v.Interface())
+		}
+		v = v.Elem()
+
+		if obj.Type == gjson.Null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if !obj.IsArray() {
+			return fmt.Errorf("expected a JSON array for %s, but got '%s'", v.Type(), obj.Raw)
+		}
+
+		items := obj.Array()
+		itemType := v.Type().Elem()
+		itemHint := interfaceHint{DefaultImpl: defaultSliceItemImpls[v.Type()], AllowedTypeIDs: allowedTypeIDs}
+		var newSlice reflect.Value
+		if !v.IsNil() && v.Cap() >= len(items) {
+			// Reusing the storage of the slice (the same as "encoding/json"
+			// does), but every item is decoded from scratch (into a zero value),
+			// and the stale items beyond the new length are cleared (so that
+			// they do not keep references).
+			for i := len(items); i < v.Len(); i++ {
+				v.Index(i).SetZero()
+			}
+			newSlice = v.Slice(0, len(items))
+		} else {
+			newSlice = reflect.MakeSlice(v.Type(), len(items), len(items))
+		}
+		for i, item := range items {
+			newSlice.Index(i).SetZero()
+			err := u.unmarshalTo(newSlice.Index(i), itemType, item, itemHint, path.Index(i))
+			if err != nil {
+				if u.collect(path.Index(i), err) {
+					continue
+				}
+				return fmt.Errorf("unable to unmarshal JSON '%s' of item #%d: %w", item, i, err)
+			}
+		}
+		v.Set(newSlice)
+		return nil
+	case reflect.Array:
+		if !needsWalk(v.Type().Elem()) {
+			// nothing polymorphic inside, the standard unmarshaler is good enough
+			return json.Unmarshal([]byte(obj.Raw), v.Interface())
+		}
+		v = v.Elem()
+
+		if obj.Type == gjson.Null {
+			// the same as in "encoding/json": null does not change an array
+			return nil
+		}
+		if !obj.IsArray() {
+			return fmt.Errorf("expected a JSON array for %s, but got '%s'", v.Type(), obj.Raw)
+		}
+
+		// The same as in "encoding/json": extra items are ignored,
+		// and missing items are set to zero values.
+		items := obj.Array()
+		itemType := v.Type().Elem()
+		for i := 0; i < v.Len(); i++ {
+			if i >= len(items) {
+				v.Index(i).Set(reflect.Zero(itemType))
+				continue
+			}
+			err := u.unmarshalTo(v.Index(i), itemType, items[i], interfaceHint{AllowedTypeIDs: allowedTypeIDs}, path.Index(i))
+			if err != nil {
+				if u.collect(path.Index(i), err) {
+					continue
+				}
+				return fmt.Errorf("unable to unmarshal JSON '%s' of item #%d: %w", items[i], i, err)
+			}
+		}
+		return nil
 	case reflect.Struct:
 		v = v.Elem()
 		t := v.Type()
 
 		// indexMap is a map of JSON field name to structure field index (could be used with Field method in reflection)
 		indexMap := map[string]int{}
+		// tags is a map of structure field index to its parsed tag
+		tags := map[int]fieldTag{}
+		// formerNames is a map of former JSON field names (see tag `polyjson:"was=..."`)
+		// to structure field index
+		var formerNames map[string]int
 		for i := 0; i < v.NumField(); i++ {
 			fT := t.Field(i)
 
-			tag := fT.Tag.Get("json")
-			if tag == "-" {
+			tag, ok := parseFieldTag(fT)
+			if !ok {
 				// requested to skip
 				continue
 			}
-			tagWords := strings.Split(tag, ",")
 
-			jsonFieldName := fT.Name
-			if len(tagWords[0]) > 0 {
-				jsonFieldName = tagWords[0]
+			indexMap[tag.Name] = i
+			tags[i] = tag
+			if was := parsePolyjsonTag(fT)["was"]; was != "" {
+				if formerNames == nil {
+					formerNames = map[string]int{}
+				}
+				for _, name := range strings.Split(was, ",") {
+					formerNames[name] = i
+				}
+			}
+		}
+		if formerNames != nil {
+			// a current name in the document takes precedence over the former ones
+			presentKeys := map[string]struct{}{}
+			obj.ForEach(func(key, _ gjson.Result) bool {
+				presentKeys[key.Str] = struct{}{}
+				return true
+			})
+			for name, i := range formerNames {
+				if _, isCurrent := indexMap[name]; isCurrent {
+					continue
+				}
+				if _, ok := presentKeys[tags[i].Name]; ok {
+					continue
+				}
+				indexMap[name] = i
 			}
+		}
 
-			indexMap[jsonFieldName] = i
+		if typeID, content, count := u.unpackWrapper(obj); count == 1 {
+			if _, isField := indexMap[typeID]; !isField && u.isTypeIDOf(TypeID(typeID), t) {
+				// The value was marshaled as an interface value (`{TypeID:{...}}`),
+				// but the destination is the concrete type, so stripping the wrapper.
+				obj = content
+			}
+		}
+
+		// a discriminator (if any) defines the TypeIDs of unwrapped interface fields
+		discriminatorField, discriminatedTypeID, err := u.parentDiscriminator(obj)
+		if err != nil {
+			return fmt.Errorf("unable to resolve the discriminator at %s: %w", path, err)
 		}
 
-		var err error
 		// Iterating through fields of the structure provided in the JSON:
 		obj.ForEach(func(key, value gjson.Result) bool {
 			fieldIndex, ok := indexMap[string(key.Str)]
 			if !ok {
 				// we have no such field in our struct
+				if u.UnknownFieldHandler != nil {
+					u.UnknownFieldHandler(path.String(), key.Str)
+				}
 				return true
 			}
 
@@ -153,9 +435,44 @@ func unmarshal(obj gjson.Result, v reflect.Value, newByTypeIDer NewByTypeIDer) e
 				return true
 			}
 
-			err = unmarshalTo(fV, fT.Type, value, newByTypeIDer)
+			tag := tags[fieldIndex]
+			original := value
+			switch {
+			case tag.HasOption("rawdecode") && value.Type == gjson.String && fT.Type.Kind() != reflect.String:
+				// The value is double-encoded: a string which contains JSON.
+				value, err = parseDoubleEncoded(value)
+			case isStringified(fT, tag) && value.Type == gjson.String:
+				// The scalar value is stored as JSON inside a JSON string.
+				value, err = parseStringified(value)
+			}
 			if err != nil {
-				err = fmt.Errorf("unable to unmarshal JSON '%s' of field '%s': %w", value, key, err)
+				if u.collect(path.Field(key.Str), err) {
+					err = nil
+					return true
+				}
+				err = fmt.Errorf("unable to unmarshal JSON '%s' of field '%s': %w", original.Raw, key, err)
+				return false
+			}
+
+			var hint interfaceHint
+			if discriminatedTypeID != "" && key.Str != discriminatorField {
+				hint.TypeID = discriminatedTypeID
+			}
+			if oneOf := parsePolyjsonTag(fT)["oneof"]; oneOf != "" {
+				if !leadsToInterface(fT.Type) {
+					err = fmt.Errorf("tag option 'oneof' is not applicable to field '%s' of type %s: it is neither an interface nor a container of interfaces", fT.Name, fT.Type)
+					return false
+				}
+				hint.AllowedTypeIDs = strings.Split(oneOf, ",")
+			}
+
+			err = u.unmarshalTo(fV, fT.Type, value, hint, path.Field(key.Str))
+			if err != nil {
+				if u.collect(path.Field(key.Str), err) {
+					err = nil
+					return true
+				}
+				err = fmt.Errorf("unable to unmarshal JSON '%s' of field '%s': %w", original, key, err)
 				return false
 			}
 			return true
@@ -163,15 +480,121 @@ func unmarshal(obj gjson.Result, v reflect.Value, newByTypeIDer NewByTypeIDer) e
 		return err
 	}
 
+	if u.NumericCoercion && isNumeric(v.Elem().Type()) {
+		if _, content, count := u.unpackWrapper(obj); count == 1 && content.Type == gjson.Number {
+			// A type-tagged number (for example {"int":1}) in a numeric slot
+			// (for example int64), using the number itself. A number, which
+			// does not fit, is rejected by json.Unmarshal below.
+			obj = content
+		}
+	}
+
 	// Everything else:
 	return json.Unmarshal([]byte(obj.Raw), v.Interface())
 }
 
-func unmarshalTo(
+// parseDoubleEncoded returns the JSON document contained
+// in the JSON string value (see tag option "rawdecode").
+func parseDoubleEncoded(value gjson.Result) (gjson.Result, error) {
+	if !gjson.Valid(value.Str) {
+		return gjson.Result{}, fmt.Errorf("the string does not contain a valid JSON document")
+	}
+	return gjson.Parse(value.Str), nil
+}
+
+// parseStringified returns the JSON scalar contained in the JSON string
+// value (see tag option "string"). Same as in "encoding/json", the string
+// should contain exactly one scalar.
+func parseStringified(value gjson.Result) (gjson.Result, error) {
+	if gjson.Valid(value.Str) {
+		if scalar := gjson.Parse(value.Str); !scalar.IsObject() && !scalar.IsArray() {
+			return scalar, nil
+		}
+	}
+	return gjson.Result{}, fmt.Errorf("the string does not contain a valid JSON scalar")
+}
+
+// parentDiscriminator returns the name of the discriminator field
+// (see WithParentDiscriminator) found in the object, and the TypeID it defines.
+func (u *unmarshaler) parentDiscriminator(obj gjson.Result) (string, TypeID, error) {
+	if len(u.ParentDiscriminators) == 0 || !obj.IsObject() {
+		return "", "", nil
+	}
+
+	var (
+		fieldName string
+		typeID    TypeID
+		err       error
+	)
+	obj.ForEach(func(key, value gjson.Result) bool {
+		for _, discriminator := range u.ParentDiscriminators {
+			if key.Str != discriminator.FieldName {
+				continue
+			}
+			var ok bool
+			typeID, ok = discriminator.Mapping[value.String()]
+			if !ok {
+				err = fmt.Errorf("unknown value '%s' of discriminator field '%s'", value.String(), key.Str)
+				return false
+			}
+			fieldName = key.Str
+			return false
+		}
+		return true
+	})
+	return fieldName, typeID, err
+}
+
+// interfaceHint is an out-of-band information about the concrete type
+// of an interface value.
+type interfaceHint struct {
+	// DefaultImpl (if not nil) overrides the default implementation
+	// of the interface (see RegisterDefaultImpl).
+	DefaultImpl reflect.Type
+
+	// TypeID (if not empty) is the TypeID of the value, which is
+	// given without the TypeID wrapper (see WithParentDiscriminator).
+	TypeID TypeID
+
+	// AllowedTypeIDs (if not empty) is the set of TypeIDs the value
+	// is allowed to have (see tag `polyjson:"oneof=..."`).
+	AllowedTypeIDs []string
+}
+
+// isAllowed returns true if the TypeID is in AllowedTypeIDs (if any).
+func (hint interfaceHint) isAllowed(typeID TypeID) bool {
+	return len(hint.AllowedTypeIDs) == 0 || slices.Contains(hint.AllowedTypeIDs, string(typeID))
+}
+
+// checkAllowedType returns ErrTypeIDNotAllowed if a value of the type t,
+// which is constructed without a TypeID in the document (for example,
+// see RegisterDefaultImpl), is not allowed by the hint. The TypeID of
+// the type is resolved through the NewByTypeIDer (if it is also
+// a TypeIDOfer), otherwise the value is not allowed.
+func (u *unmarshaler) checkAllowedType(hint interfaceHint, t reflect.Type, path valuePath) error {
+	if len(hint.AllowedTypeIDs) == 0 {
+		return nil
+	}
+	var typeID TypeID
+	if typeIDOfer, ok := u.newByTypeIDer.(TypeIDOfer); ok {
+		var err error
+		typeID, err = typeIDOfer.TypeIDOf(reflect.Zero(t).Interface())
+		if err == nil && hint.isAllowed(typeID) {
+			return nil
+		}
+	}
+	return ErrTypeIDNotAllowed{TypeID: typeID, Path: path.String(), Allowed: hint.AllowedTypeIDs}
+}
+
+// unmarshalTo unmarshals the value into out.
+//
+// The hint is used only if out is an interface.
+func (u *unmarshaler) unmarshalTo(
 	out reflect.Value,
 	outType reflect.Type,
 	value gjson.Result,
-	newByTypeIDer NewByTypeIDer,
+	hint interfaceHint,
+	path valuePath,
 ) error {
 	// By default unmarshaling directly to the field value
 	contentOut := out.Addr()
@@ -192,59 +615,375 @@ func unmarshalTo(
 			return nil
 		}
 
-		// Getting the TypeID
-
-		m := value.Map()
-		if len(m) != 1 {
-			return fmt.Errorf("expected exactly one value, but got %d", len(m))
+		if u.ErrorValues && outType == errorType {
+			errValue, err := unmarshalError(value)
+			if err != nil {
+				return err
+			}
+			out.Set(reflect.ValueOf(errValue))
+			return nil
 		}
-		var (
-			typeID        string
-			valueUnparsed gjson.Result
-			typedValuePtr any
-		)
-		// There will be only one value, unpacking it:
-		for typeID, valueUnparsed = range m {
+
+		if u.PlainScalars && hint.TypeID == "" && len(hint.AllowedTypeIDs) == 0 {
+			if scalar, ok := u.plainScalar(value, outType); ok {
+				out.Set(scalar)
+				return nil
+			}
 		}
 
 		// Generating a value with type corresponding to the TypeID
 
-		typedValuePtr, err := newByTypeIDer.NewByTypeID(TypeID(typeID))
+		typedValuePtr, valueUnparsed, err := u.newInterfaceValue(outType, value, hint, path)
 		if err != nil {
-			return fmt.Errorf("unable to construct an instance of value for TypeID '%s': %w", typeID, err)
+			return err
 		}
 
 		// Setting to unmarshal the content (JSON) to the generated value
 
 		contentOut = reflect.ValueOf(typedValuePtr)
+		if !contentOut.IsValid() {
+			return fmt.Errorf("the NewByTypeIDer returned an untyped nil for %s at %s", outType, path)
+		}
+		if contentOut.Kind() != reflect.Pointer {
+			if u.StrictAssignment {
+				return fmt.Errorf("the NewByTypeIDer returned a non-pointer value of type %s at %s", contentOut.Type(), path)
+			}
+			// Some TypeID handlers return values instead of pointers, so
+			// addressing a copy of the value (to be able to fill it, and
+			// to assign it to interfaces implemented by pointer receivers).
+			ptr, err := u.new(contentOut.Type())
+			if err != nil {
+				return fmt.Errorf("unable to allocate a value at %s: %w", path, err)
+			}
+			ptr.Elem().Set(contentOut)
+			contentOut = ptr
+		}
 		value = valueUnparsed
+
+		if u.HasEmptyContentMarker && value.Raw == string(u.EmptyContentMarker) && isObjectKind(contentOut.Type().Elem()) {
+			// see WithEmptyContentMarker
+			if err := checkEmptyContentMarker(u.EmptyContentMarker); err != nil {
+				return err
+			}
+			value = gjson.Parse(string(stringEmptyObject))
+		}
+		if value.Type == gjson.Null {
+			if nilValue, ok := u.typedNil(contentOut, outType); ok {
+				out.Set(nilValue)
+				// the generated variable is not referenced
+				u.release(contentOut.Interface())
+				return nil
+			}
+		}
 	}
 
 	// unmarshaling the content
-	err := unmarshal(value, contentOut, newByTypeIDer)
+	var err error
+	if outType.Kind() == reflect.Interface {
+		// the restriction applies to the interface value itself, not to its content
+		err = u.unmarshal(value, contentOut, path)
+	} else {
+		err = u.unmarshalRestricted(value, contentOut, path, hint.AllowedTypeIDs)
+	}
 	if err != nil {
 		return fmt.Errorf("unable to unmarshal: %w", err)
 	}
 
 	if outType.Kind() == reflect.Interface {
+		if u.PostConstruct != nil {
+			if err := u.PostConstruct(contentOut.Interface()); err != nil {
+				return fmt.Errorf("the post-construct hook failed for %s at %s: %w", contentOut.Type(), path, err)
+			}
+		}
+
 		// Since it was an interface and we generated a dedicated variable to unmarshal to,
 		// no we need to set the final value to the structure field.
 
+		storage := interfaceStorages[contentOut.Elem().Type()]
+
 		// There are few cases possible:
 		switch {
+		case storage == InterfaceStorageByPointer && contentOut.Type().AssignableTo(outType):
+			// Requested to store the pointer (see RegisterInterfaceStorage).
+			out.Set(contentOut)
+		case storage == InterfaceStorageByValue && !contentOut.Elem().Type().AssignableTo(outType):
+			return fmt.Errorf("%s is requested to be stored by value, but only %s implements %s at %s", contentOut.Elem().Type(), contentOut.Type(), outType, path)
 		case contentOut.Elem().Type().AssignableTo(outType):
 			// This is the main case. Here we just set the resulting
 			// value the the field.
 			out.Set(contentOut.Elem())
-		case contentOut.Type().AssignableTo(outType):
+			// the value is copied, so the generated variable is not referenced anymore
+			u.release(contentOut.Interface())
+		case contentOut.Type().AssignableTo(outType) && !u.StrictAssignment:
 			// Some TypeID handlers may dereference pointers, and
 			// because of this we need to get back to references,
 			// so we remove "Elem()"
 			out.Set(contentOut)
+		case u.StrictAssignment:
+			return fmt.Errorf("the NewByTypeIDer returned %s, which is not assignable to %s at %s", contentOut.Type(), outType, path)
 		default:
-			return fmt.Errorf("internal error: do not know how to assign %T to %s", contentOut.Elem(), outType)
+			return fmt.Errorf("internal error: do not know how to assign %s to %s", contentOut.Elem().Type(), outType)
 		}
 	}
 
 	return nil
 }
+
+// typedNil returns the typed nil pointer to be stored in an interface
+// of type outType for a type-tagged null (for example `{"Foo":null}`,
+// which is how a (*Foo)(nil) is marshaled), given the pointer to
+// the generated value for the TypeID.
+//
+// Returns false if null should be decoded into the generated value as is
+// (for example, the value is a slice or a map).
+func (u *unmarshaler) typedNil(contentOut reflect.Value, outType reflect.Type) (reflect.Value, bool) {
+	elemType := contentOut.Type().Elem()
+	switch elemType.Kind() {
+	case reflect.Pointer:
+		// the TypeID defines a pointer type (for example, see WithPointerTypeIDs)
+		if elemType.AssignableTo(outType) {
+			return reflect.Zero(elemType), true
+		}
+	case reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+	default:
+		// a value of such type is normally not marshaled as null, so it was a pointer
+		if contentOut.Type().AssignableTo(outType) && !u.StrictAssignment {
+			return reflect.Zero(contentOut.Type()), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// collect records the error of decoding the value at the path and returns
+// true if the errors are collected (see WithCollectErrors). The decoding
+// is still aborted on a cancellation or a timeout.
+func (u *unmarshaler) collect(path valuePath, err error) bool {
+	if !u.CollectErrors {
+		return false
+	}
+	if u.Context != nil && u.Context.Err() != nil {
+		return false
+	}
+	if errors.As(err, &ErrDecodeTimeout{}) {
+		return false
+	}
+	u.collectedErrors = append(u.collectedErrors, fmt.Errorf("%s: %w", path, err))
+	return true
+}
+
+// unmarshalMapStringAny is the same as unmarshal for a map[string]any
+// (given as an addressable value), but with less reflection.
+func (u *unmarshaler) unmarshalMapStringAny(obj gjson.Result, v reflect.Value, path valuePath, allowedTypeIDs []string) error {
+	m := v.Interface().(map[string]any)
+	if m == nil {
+		m = make(map[string]any)
+		v.Set(reflect.ValueOf(m))
+	} else {
+		// delete all entries from the current map
+		clear(m)
+	}
+
+	var err error
+	obj.ForEach(func(key, value gjson.Result) bool {
+		var item any
+		err = u.unmarshalTo(reflect.ValueOf(&item).Elem(), anyType, value, interfaceHint{AllowedTypeIDs: allowedTypeIDs}, path.Key(key.Str))
+		if err != nil {
+			if u.collect(path.Key(key.Str), err) {
+				err = nil
+				return true
+			}
+			err = fmt.Errorf("unable to unmarshal JSON '%s' of entry with key '%s': %w", value, key, err)
+			return false
+		}
+		m[key.Str] = item
+		return true
+	})
+	return err
+}
+
+// isTypeIDOf returns true if the TypeID defines the given type
+// (or a pointer to it).
+func (u *unmarshaler) isTypeIDOf(typeID TypeID, t reflect.Type) bool {
+	if registry, ok := u.newByTypeIDer.(typeRegistryT); ok {
+		if registered, ok := registry.typeOfTypeID(typeID); ok {
+			// no need to construct a value
+			return registered == t
+		}
+	}
+
+	sample, err := u.newByTypeID(typeID)
+	if err != nil || sample == nil {
+		return false
+	}
+	defer u.release(sample)
+	return typeOf(sample) == t
+}
+
+// newInterfaceContent returns a pointer to a new value of type t to be
+// stored in an interface, which content is the whole value (see newInterfaceValue).
+func (u *unmarshaler) newInterfaceContent(t reflect.Type, value gjson.Result, path valuePath) (any, gjson.Result, error) {
+	ptr, err := u.new(t)
+	if err != nil {
+		return nil, gjson.Result{}, fmt.Errorf("unable to allocate a value at %s: %w", path, err)
+	}
+	return ptr.Interface(), value, nil
+}
+
+// newInterfaceValue returns a pointer to a new value to be stored in an interface of
+// type ifaceType, and the JSON content to be unmarshaled into the value.
+func (u *unmarshaler) newInterfaceValue(
+	ifaceType reflect.Type,
+	value gjson.Result,
+	hint interfaceHint,
+	path valuePath,
+) (any, gjson.Result, error) {
+	if hint.TypeID != "" {
+		// the TypeID is already known, so the whole value is the content
+		if !hint.isAllowed(hint.TypeID) {
+			return nil, gjson.Result{}, ErrTypeIDNotAllowed{TypeID: hint.TypeID, Path: path.String(), Allowed: hint.AllowedTypeIDs}
+		}
+		typedValuePtr, err := u.newByTypeID(hint.TypeID)
+		if err != nil {
+			return nil, gjson.Result{}, fmt.Errorf("unable to construct an instance of value for TypeID '%s': %w", hint.TypeID, err)
+		}
+		u.trace(path, hint.TypeID)
+		return typedValuePtr, value, nil
+	}
+
+	defaultImpl := hint.DefaultImpl
+	if defaultImpl == nil {
+		defaultImpl = defaultImpls[ifaceType]
+	}
+
+	// Getting the TypeID
+
+	typeID, valueUnparsed, count := u.unpackWrapper(value)
+	if u.MinimalWrapping {
+		if impl, ok := u.soleImplementation(ifaceType); ok {
+			if count == 1 && hint.isAllowed(TypeID(typeID)) {
+				if typedValuePtr, err := u.newByTypeID(TypeID(typeID)); err == nil {
+					// a wrapped value (for example, from a producer without WithMinimalWrapping)
+					u.trace(path, TypeID(typeID))
+					return typedValuePtr, valueUnparsed, nil
+				}
+			}
+			// the type is unambiguous, so the whole value is the content
+			if err := u.checkAllowedType(hint, impl, path); err != nil {
+				return nil, gjson.Result{}, err
+			}
+			u.trace(path, "")
+			return u.newInterfaceContent(impl, value, path)
+		}
+	}
+	if count != 1 {
+		if u.Lenient && defaultImpl != nil {
+			// not a TypeID wrapper, so the whole value is the content
+			if err := u.checkAllowedType(hint, defaultImpl, path); err != nil {
+				return nil, gjson.Result{}, err
+			}
+			u.trace(path, "")
+			return u.newInterfaceContent(defaultImpl, value, path)
+		}
+		if !u.isWrapperContainer(value) {
+			return nil, gjson.Result{}, ErrNotTypeTagged{Path: path.String(), JSONType: jsonTypeName(value)}
+		}
+		if u.Format == FormatTupleArray {
+			return nil, gjson.Result{}, fmt.Errorf("expected a 2-item array [TypeID, content] at %s, but got '%s'", path, value.Raw)
+		}
+		return nil, gjson.Result{}, fmt.Errorf("expected exactly one value in the type-tagged object at %s, but got %d", path, count)
+	}
+
+	if !hint.isAllowed(TypeID(typeID)) {
+		return nil, gjson.Result{}, ErrTypeIDNotAllowed{TypeID: TypeID(typeID), Path: path.String(), Allowed: hint.AllowedTypeIDs}
+	}
+	typedValuePtr, err := u.newByTypeID(TypeID(typeID))
+	if err != nil {
+		if u.Lenient && defaultImpl != nil {
+			// the only key is not a TypeID, so the whole value is the content
+			if err := u.checkAllowedType(hint, defaultImpl, path); err != nil {
+				return nil, gjson.Result{}, err
+			}
+			u.trace(path, "")
+			return u.newInterfaceContent(defaultImpl, value, path)
+		}
+		return nil, gjson.Result{}, fmt.Errorf("unable to construct an instance of value for TypeID '%s': %w", typeID, err)
+	}
+
+	u.trace(path, TypeID(typeID))
+	return typedValuePtr, valueUnparsed, nil
+}
+
+// SplitTypeWrapper returns the TypeID and the content of the wrapper
+// (`{TypeID:content}`) if b is a single-key object, which key is a TypeID
+// registered in the type registry (see RegisterType and RegisterTypeAlias).
+// Only the default format is supported (see FormatWrapperObject).
+func SplitTypeWrapper(b []byte) (TypeID, json.RawMessage, bool) {
+	key, content, count := unpackWrapper(gjson.ParseBytes(b))
+	if count != 1 {
+		return "", nil, false
+	}
+	typeID := TypeID(key)
+	if _, ok := typeRegistry[typeID]; !ok {
+		if _, ok := typeAliases[typeID]; !ok {
+			return "", nil, false
+		}
+	}
+	return typeID, json.RawMessage(content.Raw), true
+}
+
+// unpackWrapper returns the key and the value of the last entry of
+// the object (to be consistent with "the last one wins" for duplicate keys),
+// and the amount of distinct keys in the object.
+func unpackWrapper(value gjson.Result) (string, gjson.Result, int) {
+	if !value.IsObject() {
+		return "", gjson.Result{}, 0
+	}
+
+	var (
+		lastKey   string
+		lastValue gjson.Result
+		keys      = map[string]struct{}{}
+	)
+	value.ForEach(func(key, item gjson.Result) bool {
+		lastKey, lastValue = key.Str, item
+		keys[key.Str] = struct{}{}
+		return true
+	})
+	return lastKey, lastValue, len(keys)
+}
+
+// jsonTypeName returns a human-readable name of the type of the JSON value.
+func jsonTypeName(value gjson.Result) string {
+	switch value.Type {
+	case gjson.Null:
+		return "null"
+	case gjson.False, gjson.True:
+		return "boolean"
+	case gjson.Number:
+		return "number"
+	case gjson.String:
+		return "string"
+	}
+	if value.IsArray() {
+		return "array"
+	}
+	return "object"
+}
+
+// unmarshalNumber assigns the raw numeric token (without any interpretation).
+func unmarshalNumber(obj gjson.Result, v reflect.Value) error {
+	switch obj.Type {
+	case gjson.Null:
+		return nil
+	case gjson.Number:
+		v.SetString(obj.Raw)
+		return nil
+	case gjson.String:
+		// the same as "encoding/json" does, accepting a quoted number
+		if gjson.Parse(obj.Str).Type == gjson.Number && gjson.Valid(obj.Str) {
+			v.SetString(obj.Str)
+			return nil
+		}
+	}
+	return fmt.Errorf("expected a number, but got '%s'", obj.Raw)
+}
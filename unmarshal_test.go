@@ -0,0 +1,1281 @@
+// Copyright 2025 Dmitrii Okunev.
+// Copyright 2023 Meta Platforms, Inc. and affiliates.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Strategy struct {
+	Name       string
+	Calculator Calculator
+}
+
+func TestUnmarshalSliceOfStructsWithInterfaces(t *testing.T) {
+	type strategies struct {
+		Strategies []Strategy
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	testObj := strategies{
+		Strategies: []Strategy{
+			{Name: "linear", Calculator: CalculatorLinear{K: 2}},
+			{Name: "const", Calculator: &CalculatorConst{C: 3}},
+			{Name: "none"},
+		},
+	}
+
+	b, err := MarshalWithTypeIDs(testObj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Strategies":[`+
+		`{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}},"Name":"linear"},`+
+		`{"Calculator":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":3}},"Name":"const"},`+
+		`{"Calculator":null,"Name":"none"}`+
+		`]}`, string(b))
+
+	var cpy strategies
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, testObj, cpy)
+
+	// top-level slice of interfaces:
+
+	calculators := []Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}}
+	b, err = MarshalWithTypeIDs(calculators, typeIDHandler)
+	require.NoError(t, err)
+
+	var calculatorsCpy []Calculator
+	err = UnmarshalWithTypeIDs(b, &calculatorsCpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, calculators, calculatorsCpy)
+}
+
+func TestUnmarshalLenientDefaultImpl(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterDefaultImpl((*Calculator)(nil), CalculatorLinear{})
+	typeIDHandler := typeIDHandlerT{}
+
+	b := []byte(`{"Name":"legacy","Calculator":{"K":2}}`)
+
+	var cpy Strategy
+	err := UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.Error(t, err)
+
+	cpy = Strategy{}
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithLenient(true))
+	require.NoError(t, err)
+	require.Equal(t, Strategy{Name: "legacy", Calculator: CalculatorLinear{K: 2}}, cpy)
+
+	// wrapped values are still resolved through the TypeID:
+	cpy = Strategy{}
+	err = UnmarshalWithTypeIDs(
+		[]byte(`{"Calculator":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":3}}}`),
+		&cpy, typeIDHandler, WithLenient(true),
+	)
+	require.NoError(t, err)
+	require.Equal(t, Strategy{Calculator: &CalculatorConst{C: 3}}, cpy)
+}
+
+func TestUnmarshalRawDecode(t *testing.T) {
+	type envelope struct {
+		Payload  Struct1    `json:",rawdecode"`
+		Calc     Calculator `json:"calc,rawdecode"`
+		Text     string     `json:",rawdecode"`
+		NotRawed Struct3
+	}
+	typeIDHandler := typeIDHandlerT{}
+
+	var cpy envelope
+	err := UnmarshalWithTypeIDs([]byte(`{
+		"Payload": "{\"int\":1,\"Iface1\":{\"github.com/xaionaro-go/polyjson.Struct3\":{\"Int2\":2}}}",
+		"calc": "{\"github.com/xaionaro-go/polyjson.CalculatorLinear\":{\"K\":3}}",
+		"Text": "{\"not\":\"decoded\"}",
+		"NotRawed": {"Int2": 4}
+	}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, envelope{
+		Payload:  Struct1{Int0: 1, Iface1: Struct3{Int2: 2}},
+		Calc:     CalculatorLinear{K: 3},
+		Text:     `{"not":"decoded"}`,
+		NotRawed: Struct3{Int2: 4},
+	}, cpy)
+
+	// not double-encoded values are still accepted:
+	cpy = envelope{}
+	err = UnmarshalWithTypeIDs([]byte(`{"Payload":{"int":5}}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, envelope{Payload: Struct1{Int0: 5}}, cpy)
+
+	// the string should contain exactly one valid JSON document:
+	for _, payload := range []string{
+		`"not json"`,
+		`"{\"int\":1} junk"`,
+	} {
+		cpy = envelope{}
+		err = UnmarshalWithTypeIDs([]byte(`{"Payload":`+payload+`}`), &cpy, typeIDHandler)
+		require.Error(t, err, payload)
+		require.Contains(t, err.Error(), payload)
+	}
+}
+
+type Plugin interface {
+	PluginName() string
+}
+
+type PluginEcho struct {
+	Prefix string
+}
+
+func (p PluginEcho) PluginName() string {
+	return "echo"
+}
+
+type PluginNoop struct{}
+
+func (p *PluginNoop) PluginName() string {
+	return "noop"
+}
+
+func TestUnmarshalLenientDefaultSliceItemImpl(t *testing.T) {
+	isolateTypeRegistry(t)
+	type plugins struct {
+		Plugins []Plugin
+		Single  Plugin
+	}
+	RegisterDefaultSliceItemImpl((*[]Plugin)(nil), PluginEcho{})
+	RegisterDefaultImpl((*Plugin)(nil), PluginNoop{})
+	typeIDHandler := typeIDHandlerT{}
+
+	b := []byte(`{"Plugins":[{"Prefix":"a"},null,{"Prefix":"b"}],"Single":{}}`)
+
+	var cpy plugins
+	err := UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.Error(t, err)
+
+	cpy = plugins{}
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithLenient(true))
+	require.NoError(t, err)
+	require.Equal(t, plugins{
+		Plugins: []Plugin{PluginEcho{Prefix: "a"}, nil, PluginEcho{Prefix: "b"}},
+		Single:  &PluginNoop{},
+	}, cpy)
+}
+
+func TestParsedDocumentInto(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	doc, err := ParseWithTypeIDs([]byte(`{"Name":"linear","Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}}}`))
+	require.NoError(t, err)
+
+	var full Strategy
+	require.NoError(t, doc.Into(&full, typeIDHandler))
+	require.Equal(t, Strategy{Name: "linear", Calculator: CalculatorLinear{K: 2}}, full)
+
+	var nameOnly struct {
+		Name string
+	}
+	require.NoError(t, doc.Into(&nameOnly, typeIDHandler))
+	require.Equal(t, "linear", nameOnly.Name)
+
+	var again Strategy
+	require.NoError(t, doc.Into(&again, typeIDHandler))
+	require.Equal(t, full, again)
+
+	_, err = ParseWithTypeIDs([]byte(`{"Name":`))
+	require.Error(t, err)
+}
+
+func TestUnmarshalRawMessage(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	b := []byte(`{"a": {"github.com/xaionaro-go/polyjson.Struct3": {"Int2": 1}}, "b": [1, 2], "c": null}`)
+
+	var entries map[string]json.RawMessage
+	err := UnmarshalWithTypeIDs(b, &entries, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, map[string]json.RawMessage{
+		"a": json.RawMessage(`{"github.com/xaionaro-go/polyjson.Struct3": {"Int2": 1}}`),
+		"b": json.RawMessage(`[1, 2]`),
+		"c": json.RawMessage(`null`),
+	}, entries)
+
+	var deferred struct {
+		A json.RawMessage `json:"a"`
+		B []int           `json:"b"`
+	}
+	err = UnmarshalWithTypeIDs(b, &deferred, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"github.com/xaionaro-go/polyjson.Struct3": {"Int2": 1}}`, string(deferred.A))
+	require.Equal(t, []int{1, 2}, deferred.B)
+
+	var later Struct2
+	err = UnmarshalWithTypeIDs([]byte(`{"Iface2":`+string(deferred.A)+`}`), &later, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, Struct2{Iface2: Struct3{Int2: 1}}, later)
+}
+
+func TestUnmarshalDuplicateKeys(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	for _, testCase := range []struct {
+		Name         string
+		JSON         string
+		Dst          func() any
+		Expected     any
+		ExpectedPath string
+	}{
+		{
+			Name:         "struct",
+			JSON:         `{"Name":"a","Name":"b"}`,
+			Dst:          func() any { return &Strategy{} },
+			Expected:     &Strategy{Name: "b"},
+			ExpectedPath: "$",
+		},
+		{
+			Name:         "map",
+			JSON:         `{"x":{"k":1},"x":{"k":2}}`,
+			Dst:          func() any { return &map[string]map[string]int{} },
+			Expected:     &map[string]map[string]int{"x": {"k": 2}},
+			ExpectedPath: "$",
+		},
+		{
+			Name: "wrapper",
+			JSON: `{"Calculator":{
+				"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1},
+				"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}
+			}}`,
+			Dst:          func() any { return &Strategy{} },
+			Expected:     &Strategy{Calculator: CalculatorLinear{K: 2}},
+			ExpectedPath: `$.Calculator`,
+		},
+		{
+			Name:         "nested_plain_slice",
+			JSON:         `{"Items":[{"Int2":1},{"Int2":2,"Int2":3}]}`,
+			Dst:          func() any { return &struct{ Items []Struct3 }{} },
+			Expected:     &struct{ Items []Struct3 }{Items: []Struct3{{Int2: 1}, {Int2: 3}}},
+			ExpectedPath: `$.Items[1]`,
+		},
+	} {
+		t.Run(testCase.Name, func(t *testing.T) {
+			dst := testCase.Dst()
+			err := UnmarshalWithTypeIDs([]byte(testCase.JSON), dst, typeIDHandler)
+			require.NoError(t, err)
+			require.Equal(t, testCase.Expected, dst)
+
+			var errDuplicate ErrDuplicateKey
+			err = UnmarshalWithTypeIDs([]byte(testCase.JSON), testCase.Dst(), typeIDHandler, WithDisallowDuplicateKeys(true))
+			require.ErrorAs(t, err, &errDuplicate)
+			require.Equal(t, testCase.ExpectedPath, errDuplicate.Path)
+		})
+	}
+}
+
+func TestUnmarshalInterfaceNotTypeTagged(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	for _, testCase := range []struct {
+		JSON             string
+		ExpectedPath     string
+		ExpectedJSONType string
+	}{
+		{JSON: `{"Calculator":1}`, ExpectedPath: "$.Calculator", ExpectedJSONType: "number"},
+		{JSON: `{"Calculator":"linear"}`, ExpectedPath: "$.Calculator", ExpectedJSONType: "string"},
+		{JSON: `{"Calculator":true}`, ExpectedPath: "$.Calculator", ExpectedJSONType: "boolean"},
+		{JSON: `{"Calculator":[1]}`, ExpectedPath: "$.Calculator", ExpectedJSONType: "array"},
+	} {
+		t.Run(testCase.JSON, func(t *testing.T) {
+			var cpy Strategy
+			err := UnmarshalWithTypeIDs([]byte(testCase.JSON), &cpy, typeIDHandler)
+			var errNotTypeTagged ErrNotTypeTagged
+			require.ErrorAs(t, err, &errNotTypeTagged)
+			require.Equal(t, testCase.ExpectedPath, errNotTypeTagged.Path)
+			require.Equal(t, testCase.ExpectedJSONType, errNotTypeTagged.JSONType)
+		})
+	}
+
+	var cpy map[string][]Calculator
+	err := UnmarshalWithTypeIDs([]byte(`{"k":[{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},2]}`), &cpy, typeIDHandler)
+	require.EqualError(t, err, `unable to unmarshal JSON '[{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},2]' of entry with key 'k': unable to unmarshal: unable to unmarshal JSON '2' of item #1: expected type-tagged value for interface value $["k"][1], got number`)
+}
+
+func TestMarshalUnmarshalSliceOfPointersToInterfaces(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	var (
+		linear Calculator = CalculatorLinear{K: 1}
+		cnst   Calculator = &CalculatorConst{C: 2}
+	)
+	testObj := []*Calculator{&linear, nil, &cnst, nil}
+
+	b, err := MarshalWithTypeIDs(testObj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `[`+
+		`{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},`+
+		`null,`+
+		`{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}},`+
+		`null`+
+		`]`, string(b))
+
+	var cpy []*Calculator
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Len(t, cpy, 4)
+	require.Nil(t, cpy[1])
+	require.Nil(t, cpy[3])
+	require.NotNil(t, cpy[0])
+	require.NotNil(t, cpy[2])
+	require.Equal(t, linear, *cpy[0])
+	require.Equal(t, cnst, *cpy[2])
+}
+
+func TestUnmarshalParentDiscriminator(t *testing.T) {
+	type strategy struct {
+		Kind       string     `json:"kind"`
+		Calculator Calculator `json:"calculator"`
+	}
+	typeIDHandler := typeIDHandlerT{}
+	opt := WithParentDiscriminator("kind", map[string]TypeID{
+		"linear": "github.com/xaionaro-go/polyjson.CalculatorLinear",
+		"const":  "*github.com/xaionaro-go/polyjson.CalculatorConst",
+	})
+
+	var cpy []strategy
+	err := UnmarshalWithTypeIDs([]byte(`[
+		{"calculator": {"K": 2}, "kind": "linear"},
+		{"kind": "const", "calculator": {"C": 3}},
+		{"kind": "const", "calculator": null}
+	]`), &cpy, typeIDHandler, opt)
+	require.NoError(t, err)
+	require.Equal(t, []strategy{
+		{Kind: "linear", Calculator: CalculatorLinear{K: 2}},
+		{Kind: "const", Calculator: &CalculatorConst{C: 3}},
+		{Kind: "const"},
+	}, cpy)
+
+	err = UnmarshalWithTypeIDs([]byte(`[{"kind": "unknown", "calculator": {}}]`), &cpy, typeIDHandler, opt)
+	require.Error(t, err)
+
+	// without the discriminator field the value is expected to be wrapped as usual
+	cpy = nil
+	err = UnmarshalWithTypeIDs([]byte(`[{"calculator": {"github.com/xaionaro-go/polyjson.CalculatorLinear": {"K": 4}}}]`), &cpy, typeIDHandler, opt)
+	require.NoError(t, err)
+	require.Equal(t, []strategy{{Calculator: CalculatorLinear{K: 4}}}, cpy)
+}
+
+func TestUnmarshalNumericCoercion(t *testing.T) {
+	type numbers struct {
+		Count *int64
+		Small int8
+		Ratio float32
+	}
+	typeIDHandler := typeIDHandlerT{}
+	b := []byte(`{"Count":{"int":1},"Small":{"int64":-2},"Ratio":{"float64":0.5}}`)
+
+	var cpy numbers
+	err := UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.Error(t, err)
+
+	cpy = numbers{}
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithNumericCoercion(true))
+	require.NoError(t, err)
+	require.Equal(t, numbers{Count: &[]int64{1}[0], Small: -2, Ratio: 0.5}, cpy)
+
+	for _, doc := range []string{
+		`{"Small":{"int":300}}`,
+		`{"Count":{"float64":1.5}}`,
+		`{"Small":{"int":"1"}}`,
+	} {
+		err = UnmarshalWithTypeIDs([]byte(doc), &cpy, typeIDHandler, WithNumericCoercion(true))
+		require.Error(t, err, doc)
+	}
+}
+
+func TestMustUnmarshalWithTypeIDs(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	obj := Strategy{Name: "linear", Calculator: CalculatorLinear{K: 2}}
+	b := MustMarshalWithTypeIDs(obj, typeIDHandler)
+
+	var cpy Strategy
+	MustUnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.Equal(t, obj, cpy)
+
+	require.Panics(t, func() {
+		MustUnmarshalWithTypeIDs([]byte(`{"Calculator":{"unknown":{}}}`), &cpy, typeIDHandler)
+	})
+	require.Panics(t, func() {
+		MustMarshalWithTypeIDs(struct{ F func() }{}, typeIDHandler)
+	})
+}
+
+func TestSliceOfInterfacesWithNils(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	obj := []Calculator{nil, CalculatorLinear{K: 1}, nil, &CalculatorConst{C: 2}, nil}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `[null,{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},null,{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}},null]`, string(b))
+
+	var cpy []Calculator
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+}
+
+func TestUnmarshalValue(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	b, err := MarshalWithTypeIDs(&[]any{&CalculatorConst{C: 3}}[0], typeIDHandler)
+	require.NoError(t, err)
+
+	v, err := UnmarshalValue(b, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, &CalculatorConst{C: 3}, v)
+
+	_, err = UnmarshalValue([]byte(`{"unknown":{}}`), typeIDHandler)
+	require.Error(t, err)
+}
+
+// valueTypeIDHandler is a TypeIDHandler, which returns values instead of pointers.
+type valueTypeIDHandler struct {
+	typeIDHandlerT
+}
+
+func (h valueTypeIDHandler) NewByTypeID(typeID TypeID) (any, error) {
+	ptr, err := h.typeIDHandlerT.NewByTypeID(typeID)
+	if err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(ptr).Elem().Interface(), nil
+}
+
+func TestUnmarshalLaxPointer(t *testing.T) {
+	typeIDHandler := valueTypeIDHandler{}
+
+	var cpy []Strategy
+	err := UnmarshalWithTypeIDs([]byte(`[
+		{"Name":"const","Calculator":{"github.com/xaionaro-go/polyjson.CalculatorConst":{"C":1}}},
+		{"Name":"linear","Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}}}
+	]`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, []Strategy{
+		{Name: "const", Calculator: &CalculatorConst{C: 1}},
+		{Name: "linear", Calculator: CalculatorLinear{K: 2}},
+	}, cpy)
+}
+
+func TestUnmarshalArrayOfStructsWithInterfaces(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type pair struct {
+		Strategies [2]Strategy
+		Plain      [2]int
+	}
+	obj := pair{
+		Strategies: [2]Strategy{
+			{Name: "linear", Calculator: CalculatorLinear{K: 1}},
+			{Name: "const", Calculator: &CalculatorConst{C: 2}},
+		},
+		Plain: [2]int{3, 4},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+
+	var cpy pair
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+
+	// the same as in "encoding/json": extra items are ignored, missing items are zeroed
+	cpy = pair{Strategies: [2]Strategy{{}, {Name: "stale"}}}
+	err = UnmarshalWithTypeIDs([]byte(`{"Strategies":[{"Name":"only"}]}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, [2]Strategy{{Name: "only"}}, cpy.Strategies)
+
+	var calcs [2]Calculator
+	err = UnmarshalWithTypeIDs([]byte(`[{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":5}},null,{"unknown":{}}]`), &calcs, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, [2]Calculator{CalculatorLinear{K: 5}, nil}, calcs)
+}
+
+func TestUnmarshalMapOfPointersToStructsWithInterfaces(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type config struct {
+		Configs map[string]*Strategy
+	}
+	obj := config{
+		Configs: map[string]*Strategy{
+			"const":  {Name: "const", Calculator: &CalculatorConst{C: 1}},
+			"linear": {Name: "linear", Calculator: CalculatorLinear{K: 2}},
+			"nil":    nil,
+			"empty":  {},
+		},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Configs":{"const":{"Calculator":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":1}},"Name":"const"},"empty":{"Calculator":null,"Name":""},"linear":{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}},"Name":"linear"},"nil":null}}`, string(b))
+
+	var cpy config
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+
+	// the same as in "encoding/json": an empty object gives an empty map, and null gives a nil map
+	err = UnmarshalWithTypeIDs([]byte(`{"Configs":{}}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.NotNil(t, cpy.Configs)
+	require.Empty(t, cpy.Configs)
+
+	err = UnmarshalWithTypeIDs([]byte(`{"Configs":null}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Nil(t, cpy.Configs)
+}
+
+type calculatorChain []Calculator
+
+func (c calculatorChain) Calculate(x float64) float64 {
+	for _, calc := range c {
+		x = calc.Calculate(x)
+	}
+	return x
+}
+
+type floats []float64
+
+func TestUnmarshalWrapperOfArray(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(calculatorChain{})
+	RegisterType(floats{})
+	RegisterType(CalculatorLinear{})
+
+	obj := map[string]any{
+		"chain":  calculatorChain{CalculatorLinear{K: 1}, calculatorChain{CalculatorLinear{K: 2}}},
+		"floats": floats{1.5, 2},
+	}
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"chain":{"calculatorChain":[{"CalculatorLinear":{"K":1}},{"calculatorChain":[{"CalculatorLinear":{"K":2}}]}]},"floats":{"floats":[1.5,2]}}`, string(b))
+
+	var cpy map[string]any
+	err = UnmarshalWithTypeIDs(b, &cpy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+
+	var strategy Strategy
+	err = UnmarshalWithTypeIDs([]byte(`{"Calculator":{"calculatorChain":[]}}`), &strategy, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, Strategy{Calculator: calculatorChain{}}, strategy)
+}
+
+func TestUnmarshalWithUnknownFieldHandler(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	var unknownFields []string
+	handler := func(path, name string) {
+		unknownFields = append(unknownFields, path+":"+name)
+	}
+
+	var cpy []Strategy
+	err := UnmarshalWithTypeIDs([]byte(`[
+		{"Name":"a","Extra":1,"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1,"B":2}}},
+		{"Name":"b","Map":{"x":1}}
+	]`), &cpy, typeIDHandler, WithUnknownFieldHandler(handler))
+	require.NoError(t, err)
+	require.Equal(t, []Strategy{{Name: "a", Calculator: CalculatorLinear{K: 1}}, {Name: "b"}}, cpy)
+	require.Equal(t, []string{"$[0]:Extra", "$[0].Calculator:B", "$[1]:Map"}, unknownFields)
+}
+
+func TestUnmarshalWrapperIntoConcreteStruct(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	b, err := MarshalWithTypeIDs(&[]Calculator{CalculatorLinear{K: 3}}[0], typeIDHandler)
+	require.NoError(t, err)
+	var linear CalculatorLinear
+	err = UnmarshalWithTypeIDs(b, &linear, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, CalculatorLinear{K: 3}, linear)
+
+	var constPtr *CalculatorConst
+	err = UnmarshalWithTypeIDs([]byte(`{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":4}}`), &constPtr, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, &CalculatorConst{C: 4}, constPtr)
+
+	// the wrapper is recognized according to the format
+	linear = CalculatorLinear{}
+	err = UnmarshalWithTypeIDs([]byte(`["github.com/xaionaro-go/polyjson.CalculatorLinear",{"K":5}]`), &linear, typeIDHandler, WithFormat(FormatTupleArray))
+	require.NoError(t, err)
+	require.Equal(t, CalculatorLinear{K: 5}, linear)
+
+	// a TypeID of another type is not stripped
+	linear = CalculatorLinear{}
+	err = UnmarshalWithTypeIDs([]byte(`{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"K":4}}`), &linear, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, CalculatorLinear{}, linear)
+}
+
+// cancellingTypeIDHandler cancels the context on the first construction of a value.
+type cancellingTypeIDHandler struct {
+	typeIDHandlerT
+	cancel context.CancelFunc
+	calls  *int
+}
+
+func (h cancellingTypeIDHandler) NewByTypeID(typeID TypeID) (any, error) {
+	*h.calls++
+	h.cancel()
+	return h.typeIDHandlerT.NewByTypeID(typeID)
+}
+
+func TestUnmarshalWithTypeIDsContext(t *testing.T) {
+	obj := make([]Strategy, 100)
+	for i := range obj {
+		obj[i] = Strategy{Calculator: CalculatorLinear{K: float64(i)}}
+	}
+	b, err := MarshalWithTypeIDs(obj, typeIDHandlerT{})
+	require.NoError(t, err)
+
+	var cpy []Strategy
+	err = UnmarshalWithTypeIDsContext(context.Background(), b, &cpy, typeIDHandlerT{})
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err = UnmarshalWithTypeIDsContext(ctx, b, &cpy, cancellingTypeIDHandler{cancel: cancel, calls: &calls})
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestUnmarshalSliceReusesCapacity(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	buf := make([]Strategy, 3, 4)
+	buf[0] = Strategy{Name: "stale0", Calculator: CalculatorLinear{K: 10}}
+	buf[1] = Strategy{Name: "stale1"}
+	buf[2] = Strategy{Name: "stale2", Calculator: &CalculatorConst{C: 20}}
+	storage := &buf[:cap(buf)][0]
+
+	cpy := buf
+	err := UnmarshalWithTypeIDs([]byte(`[{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}}]`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, []Strategy{{Calculator: CalculatorLinear{K: 1}}}, cpy)
+	require.Same(t, storage, &cpy[:cap(cpy)][0])
+
+	// stale items beyond the new length are cleared
+	require.Equal(t, []Strategy{{Calculator: CalculatorLinear{K: 1}}, {}, {}, {}}, buf[:cap(buf)])
+
+	// not enough capacity
+	err = UnmarshalWithTypeIDs([]byte(`[{"Name":"a"},{"Name":"b"},{"Name":"c"},{"Name":"d"},{"Name":"e"}]`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Len(t, cpy, 5)
+	require.NotSame(t, storage, &cpy[0])
+}
+
+func TestUnmarshalOneOf(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type restricted struct {
+		Calculator Calculator `json:"calc" polyjson:"oneof=github.com/xaionaro-go/polyjson.CalculatorLinear,*github.com/xaionaro-go/polyjson.CalculatorConst"`
+		Any        any        `polyjson:"oneof=github.com/xaionaro-go/polyjson.CalculatorLinear"`
+	}
+
+	var cpy restricted
+	err := UnmarshalWithTypeIDs([]byte(`{
+		"calc":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":1}},
+		"Any":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}}
+	}`), &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, restricted{Calculator: &CalculatorConst{C: 1}, Any: CalculatorLinear{K: 2}}, cpy)
+
+	err = UnmarshalWithTypeIDs([]byte(`{"Any":{"github.com/xaionaro-go/polyjson.Struct1":{}}}`), &cpy, typeIDHandler)
+	var errNotAllowed ErrTypeIDNotAllowed
+	require.ErrorAs(t, err, &errNotAllowed)
+	require.Equal(t, ErrTypeIDNotAllowed{
+		TypeID:  "github.com/xaionaro-go/polyjson.Struct1",
+		Path:    "$.Any",
+		Allowed: []string{"github.com/xaionaro-go/polyjson.CalculatorLinear"},
+	}, errNotAllowed)
+
+	t.Run("containers", func(t *testing.T) {
+		type containers struct {
+			Slice   []Calculator          `polyjson:"oneof=github.com/xaionaro-go/polyjson.CalculatorLinear"`
+			Array   [1]Calculator         `polyjson:"oneof=github.com/xaionaro-go/polyjson.CalculatorLinear"`
+			Map     map[string]Calculator `polyjson:"oneof=github.com/xaionaro-go/polyjson.CalculatorLinear"`
+			Any     map[string]any        `polyjson:"oneof=github.com/xaionaro-go/polyjson.CalculatorLinear"`
+			Pointer *Calculator           `polyjson:"oneof=github.com/xaionaro-go/polyjson.CalculatorLinear"`
+		}
+
+		linear := `{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}`
+		var cpy containers
+		err := UnmarshalWithTypeIDs([]byte(`{"Slice":[`+linear+`],"Array":[`+linear+`],"Map":{"a":`+linear+`},"Any":{"a":`+linear+`},"Pointer":`+linear+`}`), &cpy, typeIDHandler)
+		require.NoError(t, err)
+		calc := Calculator(CalculatorLinear{K: 1})
+		require.Equal(t, containers{
+			Slice:   []Calculator{CalculatorLinear{K: 1}},
+			Array:   [1]Calculator{CalculatorLinear{K: 1}},
+			Map:     map[string]Calculator{"a": CalculatorLinear{K: 1}},
+			Any:     map[string]any{"a": CalculatorLinear{K: 1}},
+			Pointer: &calc,
+		}, cpy)
+
+		constant := `{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":1}}`
+		for field, doc := range map[string]string{
+			"Slice[0]": `{"Slice":[` + constant + `]}`,
+			"Array[0]": `{"Array":[` + constant + `]}`,
+			`Map["a"]`: `{"Map":{"a":` + constant + `}}`,
+			`Any["a"]`: `{"Any":{"a":` + constant + `}}`,
+			"Pointer":  `{"Pointer":` + constant + `}`,
+		} {
+			var cpy containers
+			err := UnmarshalWithTypeIDs([]byte(doc), &cpy, typeIDHandler)
+			var errNotAllowed ErrTypeIDNotAllowed
+			require.ErrorAs(t, err, &errNotAllowed, field)
+			require.Equal(t, "$."+field, errNotAllowed.Path)
+		}
+	})
+
+	t.Run("not_interface", func(t *testing.T) {
+		type invalid struct {
+			Calc CalculatorLinear `polyjson:"oneof=github.com/xaionaro-go/polyjson.CalculatorLinear"`
+		}
+		var cpy invalid
+		err := UnmarshalWithTypeIDs([]byte(`{"Calc":{"K":1}}`), &cpy, typeIDHandler)
+		require.ErrorContains(t, err, "'oneof' is not applicable")
+	})
+
+	t.Run("default_impl", func(t *testing.T) {
+		isolateTypeRegistry(t)
+		RegisterDefaultImpl((*Calculator)(nil), CalculatorLinear{})
+		type restrictedConst struct {
+			Calc Calculator `polyjson:"oneof=*github.com/xaionaro-go/polyjson.CalculatorConst"`
+		}
+		var cpy restrictedConst
+		err := UnmarshalWithTypeIDs([]byte(`{"Calc":{"K":1,"C":2}}`), &cpy, typeIDHandler, WithLenient(true))
+		var errNotAllowed ErrTypeIDNotAllowed
+		require.ErrorAs(t, err, &errNotAllowed)
+		require.Equal(t, TypeID("github.com/xaionaro-go/polyjson.CalculatorLinear"), errNotAllowed.TypeID)
+
+		err = UnmarshalWithTypeIDs([]byte(`{"Calc":{"K":1}}`), &cpy, typeIDHandler, WithLenient(true))
+		require.ErrorAs(t, err, &errNotAllowed)
+	})
+}
+
+func TestUnmarshalTopLevelMapOfInterfaces(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	obj := map[string]Calculator{
+		"const":  &CalculatorConst{C: 1},
+		"linear": CalculatorLinear{K: 2},
+		"nil":    nil,
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"const":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":1}},"linear":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}},"nil":null}`, string(b))
+
+	cpy := map[string]Calculator{"stale": CalculatorLinear{}}
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+
+	err = UnmarshalWithTypeIDs([]byte(`{"a":{"K":1}}`), &cpy, typeIDHandler)
+	require.ErrorContains(t, err, "TypeID 'K'")
+}
+
+func TestUnmarshalWithStrictAssignment(t *testing.T) {
+	doc := []byte(`{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorConst":{"C":1}}}`)
+
+	// typeIDHandlerT returns *CalculatorConst, which could be assigned only by the pointer
+	var cpy Strategy
+	err := UnmarshalWithTypeIDs(doc, &cpy, typeIDHandlerT{})
+	require.NoError(t, err)
+	require.Equal(t, Strategy{Calculator: &CalculatorConst{C: 1}}, cpy)
+
+	err = UnmarshalWithTypeIDs(doc, &cpy, typeIDHandlerT{}, WithStrictAssignment(true))
+	require.ErrorContains(t, err, "not assignable")
+
+	// a handler returning values instead of pointers
+	err = UnmarshalWithTypeIDs(
+		[]byte(`{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}}`),
+		&cpy, valueTypeIDHandler{}, WithStrictAssignment(true),
+	)
+	require.ErrorContains(t, err, "non-pointer")
+
+	// the primary path
+	err = UnmarshalWithTypeIDs(
+		[]byte(`{"Calculator":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}}}`),
+		&cpy, typeIDHandlerT{}, WithStrictAssignment(true),
+	)
+	require.NoError(t, err)
+	require.Equal(t, Strategy{Calculator: &CalculatorConst{C: 2}}, cpy)
+}
+
+func TestUnmarshalMapOfArraysOfInterfaces(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type config struct {
+		Strategies map[string][3]Calculator
+	}
+	obj := config{
+		Strategies: map[string][3]Calculator{
+			"a": {CalculatorLinear{K: 1}, nil, &CalculatorConst{C: 2}},
+			"b": {},
+		},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Strategies":{"a":[{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},null,{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}}],"b":[null,null,null]}}`, string(b))
+
+	var cpy config
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, obj, cpy)
+}
+
+func TestUnmarshalWithDisallowTrailingData(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	const doc = `{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}}`
+
+	var s Strategy
+	require.NoError(t, UnmarshalWithTypeIDs([]byte(doc+" \n"), &s, typeIDHandler, WithDisallowTrailingData(true)))
+	require.Equal(t, Strategy{Calculator: CalculatorLinear{K: 1}}, s)
+
+	s = Strategy{}
+	require.NoError(t, UnmarshalWithTypeIDs([]byte(doc+doc), &s, typeIDHandler))
+	require.Equal(t, Strategy{Calculator: CalculatorLinear{K: 1}}, s)
+
+	var errTrailing ErrTrailingData
+	err := UnmarshalWithTypeIDs([]byte(doc+"\n"+doc), &Strategy{}, typeIDHandler, WithDisallowTrailingData(true))
+	require.ErrorAs(t, err, &errTrailing)
+	require.Equal(t, int64(len(doc)), errTrailing.Offset)
+
+	// the same for a parsed document
+	err = newParsedDocument([]byte(doc+"\n"+doc)).Into(&Strategy{}, typeIDHandler, WithDisallowTrailingData(true))
+	require.ErrorAs(t, err, &errTrailing)
+	parsed, err := ParseWithTypeIDs([]byte(doc))
+	require.NoError(t, err)
+	require.NoError(t, parsed.Into(&Strategy{}, typeIDHandler, WithDisallowTrailingData(true)))
+}
+
+// slowTypeIDHandler sleeps on every construction of a value.
+type slowTypeIDHandler struct {
+	typeIDHandlerT
+	delay time.Duration
+	calls *int
+}
+
+func (h slowTypeIDHandler) NewByTypeID(typeID TypeID) (any, error) {
+	*h.calls++
+	time.Sleep(h.delay)
+	return h.typeIDHandlerT.NewByTypeID(typeID)
+}
+
+func TestUnmarshalWithDecodeTimeout(t *testing.T) {
+	obj := make([]Strategy, 100)
+	for i := range obj {
+		obj[i] = Strategy{Calculator: CalculatorLinear{K: float64(i)}}
+	}
+	b, err := MarshalWithTypeIDs(obj, typeIDHandlerT{})
+	require.NoError(t, err)
+
+	var cpy []Strategy
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandlerT{}, WithDecodeTimeout(time.Minute)))
+	require.Equal(t, obj, cpy)
+
+	var calls int
+	var errTimeout ErrDecodeTimeout
+	err = UnmarshalWithTypeIDs(b, &cpy, slowTypeIDHandler{delay: 10 * time.Millisecond, calls: &calls}, WithDecodeTimeout(time.Millisecond))
+	require.ErrorAs(t, err, &errTimeout)
+	require.Equal(t, time.Millisecond, errTimeout.Timeout)
+	require.Equal(t, 1, calls)
+}
+
+func TestUnmarshalTypedNilBehindInterface(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(CalculatorConst{})
+	RegisterType(floats{})
+	type holder struct {
+		Any        any
+		Calculator Calculator
+	}
+	obj := holder{
+		Any:        (*CalculatorConst)(nil),
+		Calculator: (*CalculatorConst)(nil),
+	}
+
+	for name, typeIDHandler := range map[string]TypeIDHandler{
+		"pointer_aware_handler": typeIDHandlerT{},
+		"registry":              TypeRegistry(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+			require.NoError(t, err)
+
+			var cpy holder
+			require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+			require.Equal(t, obj, cpy)
+			require.Nil(t, cpy.Any.(*CalculatorConst))
+			require.Nil(t, cpy.Calculator.(*CalculatorConst))
+
+			// the generated values are released
+			releaser := &countingReleaser{NewByTypeIDer: typeIDHandler}
+			require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, releaser))
+			require.Equal(t, obj, cpy)
+			require.Len(t, releaser.released, 2)
+		})
+	}
+
+	// a nil slice is still decoded as a nil slice (not as a nil pointer to it)
+	var cpy any
+	require.NoError(t, UnmarshalWithTypeIDs([]byte(`{"floats":null}`), &cpy, TypeRegistry()))
+	require.Equal(t, floats(nil), cpy)
+}
+
+func TestUnmarshalWithPostConstruct(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	b := []byte(`[{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":2}},null]`)
+
+	var constructed []any
+	var cpy []Calculator
+	err := UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithPostConstruct(func(value any) error {
+		constructed = append(constructed, value)
+		if linear, ok := value.(*CalculatorLinear); ok {
+			linear.K *= 10
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	require.Equal(t, []Calculator{CalculatorLinear{K: 10}, &CalculatorConst{C: 2}, nil}, cpy)
+	require.Len(t, constructed, 2)
+
+	errHook := errors.New("no dependencies")
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithPostConstruct(func(any) error { return errHook }))
+	require.ErrorIs(t, err, errHook)
+}
+
+func TestUnmarshalFormerFieldNames(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type strategy struct {
+		Title      string     `json:"title" polyjson:"was=name,Name"`
+		Calculator Calculator `polyjson:"was=Calc"`
+	}
+
+	for _, doc := range []string{
+		`{"name":"s","Calc":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}}`,
+		`{"Name":"s","Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}}`,
+		`{"title":"s","name":"old","Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"Calc":null}`,
+	} {
+		var cpy strategy
+		require.NoError(t, UnmarshalWithTypeIDs([]byte(doc), &cpy, typeIDHandler), doc)
+		require.Equal(t, strategy{Title: "s", Calculator: CalculatorLinear{K: 1}}, cpy, doc)
+	}
+
+	// the current name is always used on marshal
+	b, err := MarshalWithTypeIDs(strategy{Title: "s"}, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":null,"title":"s"}`, string(b))
+}
+
+func TestUnmarshalWithCollectErrors(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type doc struct {
+		Name        string
+		Calculators []Calculator
+		ByName      map[string]Calculator
+		Count       int
+	}
+	b := []byte(`{
+		"Name": 1,
+		"Calculators": [{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}}, {"unknown":{}}],
+		"ByName": {"a": 1, "b": {"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}}},
+		"Count": 3
+	}`)
+
+	var cpy doc
+	err := UnmarshalWithTypeIDs(b, &cpy, typeIDHandler)
+	require.Error(t, err)
+	require.Equal(t, doc{}, cpy)
+
+	cpy = doc{}
+	err = UnmarshalWithTypeIDs(b, &cpy, typeIDHandler, WithCollectErrors(true))
+	require.Error(t, err)
+	lines := strings.Split(err.Error(), "\n")
+	require.Len(t, lines, 3, err.Error())
+	require.True(t, strings.HasPrefix(lines[0], "$.Name: "), lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "$.Calculators[1]: "), lines[1])
+	require.True(t, strings.HasPrefix(lines[2], `$.ByName["a"]: `), lines[2])
+	require.ErrorAs(t, err, &ErrNotTypeTagged{})
+	require.Equal(t, doc{
+		Calculators: []Calculator{CalculatorLinear{K: 1}, nil},
+		ByName:      map[string]Calculator{"b": CalculatorLinear{K: 2}},
+		Count:       3,
+	}, cpy)
+}
+
+func TestUnmarshalBytesBehindInterface(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterTypeAs("bytes", []byte(nil))
+	type holder struct {
+		V any
+	}
+
+	for _, obj := range []any{
+		holder{V: []byte("hi")},
+		map[string]any{"a": []byte("hi"), "empty": []byte{}, "nil": []byte(nil)},
+	} {
+		b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+		require.NoError(t, err)
+
+		cpy := reflect.New(reflect.TypeOf(obj))
+		require.NoError(t, UnmarshalWithTypeIDs(b, cpy.Interface(), TypeRegistry()))
+		require.Equal(t, obj, cpy.Elem().Interface(), string(b))
+	}
+
+	b, err := MarshalWithTypeIDs(holder{V: []byte("hi")}, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"V":{"bytes":"aGk="}}`, string(b))
+}
+
+func TestUnmarshalMapNilEntries(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	t.Run("map_string_any", func(t *testing.T) {
+		obj := map[string]any{"k": nil, "a": CalculatorLinear{K: 1}}
+		b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+		require.NoError(t, err)
+		require.Equal(t, `{"a":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"k":null}`, string(b))
+
+		// the existing entries are cleared, but the nil entry is kept
+		cpy := map[string]any{"stale": 1, "k": 2}
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+		require.Equal(t, obj, cpy)
+		v, ok := cpy["k"]
+		require.True(t, ok)
+		require.Nil(t, v)
+	})
+
+	t.Run("map_of_interfaces", func(t *testing.T) {
+		obj := map[string]Calculator{"k": nil, "a": CalculatorLinear{K: 1}}
+		b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+		require.NoError(t, err)
+		require.Equal(t, `{"a":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":1}},"k":null}`, string(b))
+
+		cpy := map[string]Calculator{"stale": CalculatorLinear{}, "k": CalculatorLinear{K: 2}}
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+		require.Equal(t, obj, cpy)
+		v, ok := cpy["k"]
+		require.True(t, ok)
+		require.Nil(t, v)
+	})
+}
+
+type stringifiedCalculator struct {
+	ID    int64   `json:",string"`
+	K     float64 `json:"k,string"`
+	Valid bool    `json:",string"`
+}
+
+func (c stringifiedCalculator) Calculate(x float64) float64 {
+	return c.K * x
+}
+
+func TestUnmarshalStringifiedFieldsBehindInterface(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(stringifiedCalculator{})
+	typeIDHandler := TypeRegistry()
+	obj := struct {
+		Calculator  Calculator
+		Calculators []Calculator
+		Dict        map[string]any
+	}{
+		Calculator:  stringifiedCalculator{ID: 42, K: 1.5, Valid: true},
+		Calculators: []Calculator{stringifiedCalculator{ID: 1 << 60}},
+		Dict:        map[string]any{"a": stringifiedCalculator{ID: -1}},
+	}
+
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `{"stringifiedCalculator":{"ID":"42","Valid":"true","k":"1.5"}}`)
+
+	cpy := obj
+	cpy.Calculator, cpy.Calculators, cpy.Dict = nil, nil, nil
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+	require.Equal(t, obj, cpy)
+
+	// a producer stored the number quoted
+	var calculator Calculator
+	require.NoError(t, UnmarshalWithTypeIDs([]byte(`{"stringifiedCalculator":{"ID":"7"}}`), &calculator, typeIDHandler))
+	require.Equal(t, stringifiedCalculator{ID: 7}, calculator)
+}
+
+// calculatorAlias allows to embed Calculator as an unexported field.
+type calculatorAlias = Calculator
+
+type embeddedInterfaceSample struct {
+	Calculator
+	N int
+}
+
+type embeddedInterfaceTagged struct {
+	Calculator `json:"calc,omitempty"`
+}
+
+func TestUnmarshalEmbeddedInterface(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+
+	obj := embeddedInterfaceSample{Calculator: CalculatorLinear{K: 2}, N: 1}
+	b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":2}},"N":1}`, string(b))
+
+	var cpy embeddedInterfaceSample
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+	require.Equal(t, obj, cpy)
+	require.Equal(t, float64(6), cpy.Calculate(3))
+
+	b, err = MarshalWithTypeIDs(embeddedInterfaceSample{}, typeIDHandler)
+	require.NoError(t, err)
+	require.Equal(t, `{"Calculator":null,"N":0}`, string(b))
+
+	t.Run("tagged", func(t *testing.T) {
+		obj := embeddedInterfaceTagged{Calculator: &CalculatorConst{C: 1}}
+		b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+		require.NoError(t, err)
+		require.Equal(t, `{"calc":{"*github.com/xaionaro-go/polyjson.CalculatorConst":{"C":1}}}`, string(b))
+
+		var cpy embeddedInterfaceTagged
+		require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, typeIDHandler))
+		require.Equal(t, obj, cpy)
+
+		b, err = MarshalWithTypeIDs(embeddedInterfaceTagged{}, typeIDHandler)
+		require.NoError(t, err)
+		require.Equal(t, `{}`, string(b))
+	})
+
+	t.Run("unexported", func(t *testing.T) {
+		type unexported struct {
+			calculatorAlias
+			N int
+		}
+		obj := unexported{calculatorAlias: CalculatorLinear{}, N: 1}
+		b, err := MarshalWithTypeIDs(obj, typeIDHandler)
+		require.NoError(t, err)
+		require.Equal(t, `{"N":1}`, string(b))
+
+		// the same as "encoding/json" does
+		expected, err := json.Marshal(obj)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(b))
+	})
+}
+
+type colorEnum int
+
+const (
+	colorRed = colorEnum(iota)
+	colorGreen
+	colorBlue
+)
+
+func (c colorEnum) String() string {
+	return [...]string{"red", "green", "blue"}[c]
+}
+
+func TestUnmarshalIntBackedEnumBehindInterface(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterTypeAs("Color", colorGreen)
+
+	obj := struct {
+		Color   fmt.Stringer
+		Colors  []fmt.Stringer
+		Any     any
+		Pointer fmt.Stringer
+	}{
+		Color:   colorBlue,
+		Colors:  []fmt.Stringer{colorRed, colorGreen},
+		Any:     colorGreen,
+		Pointer: &[]colorEnum{colorBlue}[0],
+	}
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{"Any":{"Color":1},"Color":{"Color":2},"Colors":[{"Color":0},{"Color":1}],"Pointer":{"Color":2}}`, string(b))
+
+	cpy := obj
+	cpy.Color, cpy.Colors, cpy.Any, cpy.Pointer = nil, nil, nil, nil
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, TypeRegistry()))
+	require.Equal(t, colorBlue, cpy.Color)
+	require.Equal(t, []fmt.Stringer{colorRed, colorGreen}, cpy.Colors)
+	require.Equal(t, colorGreen, cpy.Any)
+	require.Equal(t, colorBlue, cpy.Pointer, "values and pointers share the TypeID")
+	require.Equal(t, "blue", cpy.Color.String())
+
+	var dst fmt.Stringer
+	err = UnmarshalWithTypeIDs([]byte(`{"Color":"blue"}`), &dst, TypeRegistry())
+	require.Error(t, err)
+}
+
+func TestUnmarshalMapStringAnyOfSlicesOfInterfaces(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(CalculatorLinear{})
+	RegisterType(&CalculatorConst{})
+	// the slice itself is stored in "any", so it requires a TypeID as well
+	RegisterTypeAs("Calculators", []Calculator{})
+
+	obj := map[string]any{
+		"batch": []Calculator{CalculatorLinear{K: 1}, &CalculatorConst{C: 2}, nil},
+		"empty": []Calculator{},
+	}
+	b, err := MarshalWithTypeIDs(obj, TypeRegistry())
+	require.NoError(t, err)
+	require.Equal(t, `{`+
+		`"batch":{"Calculators":[{"CalculatorLinear":{"K":1}},{"CalculatorConst":{"C":2}},null]},`+
+		`"empty":{"Calculators":[]}}`, string(b))
+
+	var cpy map[string]any
+	require.NoError(t, UnmarshalWithTypeIDs(b, &cpy, TypeRegistry()))
+	require.Equal(t, obj, cpy)
+}
+
+type countingReleaser struct {
+	NewByTypeIDer
+	released []any
+}
+
+func (r *countingReleaser) Release(value any) {
+	r.released = append(r.released, value)
+}
+
+func TestUnmarshalWrapperIntoConcreteStructResolving(t *testing.T) {
+	isolateTypeRegistry(t)
+	RegisterType(CalculatorLinear{})
+
+	// the TypeID is resolved the same way as for interfaces
+	var linear CalculatorLinear
+	err := UnmarshalWithTypeIDs(
+		[]byte(`{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":3}}`),
+		&linear, TypeRegistry(), WithTypeIDNormalization(true),
+	)
+	require.NoError(t, err)
+	require.Equal(t, CalculatorLinear{K: 3}, linear)
+
+	// the sample constructed to check the TypeID is released
+	releaser := &countingReleaser{NewByTypeIDer: typeIDHandlerT{}}
+	linear = CalculatorLinear{}
+	err = UnmarshalWithTypeIDs([]byte(`{"github.com/xaionaro-go/polyjson.CalculatorLinear":{"K":4}}`), &linear, releaser)
+	require.NoError(t, err)
+	require.Equal(t, CalculatorLinear{K: 4}, linear)
+	require.Equal(t, []any{&CalculatorLinear{}}, releaser.released)
+}
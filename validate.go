@@ -0,0 +1,91 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/tidwall/gjson"
+)
+
+// Validate checks that the document could be decoded: every type-tagged value
+// (see ScanTypeIDs) has a TypeID known to the NewByTypeIDer, and its content
+// is decodable into the type defined by the TypeID. It allows to check
+// user-submitted documents before accepting them. The values are decoded into
+// throwaway variables, and all the found problems are returned joined
+// (see WithCollectErrors).
+//
+// Since the document has no schema, the values outside of type-tagged
+// values are not checked (besides the JSON syntax).
+func Validate(b []byte, newByTypeIDer NewByTypeIDer, opts ...Option) error {
+	if !gjson.ValidBytes(b) {
+		return fmt.Errorf("invalid JSON")
+	}
+
+	u := &unmarshaler{
+		newByTypeIDer: newByTypeIDer,
+		config:        Options(opts).config(),
+	}
+	u.CollectErrors = true
+	root := gjson.ParseBytes(b)
+	if u.DisallowDuplicateKeys {
+		if err := checkDuplicateKeys(root, nil); err != nil {
+			return err
+		}
+	}
+
+	u.validate(root, nil)
+	return errors.Join(u.collectedErrors...)
+}
+
+func (u *unmarshaler) validate(value gjson.Result, path valuePath) {
+	key, content, count := u.unpackWrapper(value)
+	if count == 1 {
+		typedValuePtr, err := u.newByTypeID(TypeID(key))
+		if err == nil && typedValuePtr == nil {
+			err = fmt.Errorf("the NewByTypeIDer returned an untyped nil")
+		}
+		switch {
+		case err == nil:
+			ptr := reflect.ValueOf(typedValuePtr)
+			if ptr.Kind() != reflect.Pointer {
+				// see unmarshalTo
+				ptr, err = u.new(ptr.Type())
+				if err != nil {
+					u.collect(path, err)
+					return
+				}
+			}
+			if err := u.unmarshal(content, ptr, path); err != nil {
+				u.collect(path, err)
+			}
+			return
+		case looksLikeTypeID(key):
+			u.collect(path, fmt.Errorf("unable to construct an instance of value for TypeID '%s': %w", key, err))
+			return
+		}
+	}
+
+	switch {
+	case value.IsObject():
+		value.ForEach(func(key, item gjson.Result) bool {
+			u.validate(item, path.Member(key.Str))
+			return true
+		})
+	case value.IsArray():
+		for idx, item := range value.Array() {
+			u.validate(item, path.Index(idx))
+		}
+	}
+}
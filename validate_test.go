@@ -0,0 +1,58 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package polyjson
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	typeIDHandler := typeIDHandlerT{}
+	type doc struct {
+		Strategies []Strategy
+		Extra      map[string]any
+	}
+	b, err := MarshalWithTypeIDs(doc{
+		Strategies: []Strategy{{Name: "a", Calculator: CalculatorLinear{K: 1}}},
+		Extra:      map[string]any{"c": &CalculatorConst{C: 2}},
+	}, typeIDHandler)
+	require.NoError(t, err)
+	require.NoError(t, Validate(b, typeIDHandler))
+
+	err = Validate([]byte(`{
+		"Strategies": [{"Calculator": {"github.com/xaionaro-go/polyjson.CalculatorLinear": {"K": "one"}}}],
+		"Extra": {
+			"c": {"github.com/my/app.Unknown": {}},
+			"d": {"github.com/xaionaro-go/polyjson.Struct1": {"Iface1": {"github.com/my/app.Unknown": {}}}}
+		}
+	}`), typeIDHandler)
+	require.Error(t, err)
+	lines := strings.Split(err.Error(), "\n")
+	require.Len(t, lines, 3, err.Error())
+	require.True(t, strings.HasPrefix(lines[0], `$.Strategies[0].Calculator.K: `), lines[0])
+	require.True(t, strings.HasPrefix(lines[1], `$.Extra.c: `), lines[1])
+	require.True(t, strings.HasPrefix(lines[2], `$.Extra.d.Iface1: `), lines[2])
+
+	// the wrappers are parsed according to the format
+	b, err = MarshalWithTypeIDs(doc{
+		Strategies: []Strategy{{Name: "a", Calculator: CalculatorLinear{K: 1}}},
+	}, typeIDHandler, WithFormat(FormatTupleArray))
+	require.NoError(t, err)
+	require.NoError(t, Validate(b, typeIDHandler, WithFormat(FormatTupleArray)))
+	err = Validate([]byte(`{"Strategies":[{"Calculator":["github.com/xaionaro-go/polyjson.CalculatorLinear",{"K":"one"}]}]}`), typeIDHandler, WithFormat(FormatTupleArray))
+	require.ErrorContains(t, err, `$.Strategies[0].Calculator.K: `)
+
+	require.Error(t, Validate([]byte(`{`), typeIDHandler))
+}
@@ -0,0 +1,52 @@
+// Copyright 2025 Dmitrii Okunev.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package polyjson
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// valuePath is a path to a value inside a document, for example: $.Field["key"][1]
+type valuePath []string
+
+// Field returns the path to the given field of the structure.
+func (p valuePath) Field(name string) valuePath {
+	return append(p[:len(p):len(p)], "."+name)
+}
+
+// Key returns the path to the given entry of the map.
+func (p valuePath) Key(key string) valuePath {
+	return append(p[:len(p):len(p)], fmt.Sprintf("[%q]", key))
+}
+
+// Member returns the path to the given member of an object, which type
+// is unknown (a structure or a map): the same as Field if the key looks
+// like a field name, otherwise the same as Key.
+func (p valuePath) Member(key string) valuePath {
+	if token.IsIdentifier(key) {
+		return p.Field(key)
+	}
+	return p.Key(key)
+}
+
+// Index returns the path to the given item of the slice or array.
+func (p valuePath) Index(idx int) valuePath {
+	return append(p[:len(p):len(p)], fmt.Sprintf("[%d]", idx))
+}
+
+// String implements fmt.Stringer.
+func (p valuePath) String() string {
+	return "$" + strings.Join(p, "")
+}